@@ -2,10 +2,14 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // A Cmd represents a command with flags and positional arguments.
@@ -17,20 +21,42 @@ import (
 //
 // The Summary and Details fields are printed at the beginning and end, respectively, of the help
 // message. They won’t be printed if left empty.
+//
+// If Hidden is set, a command that’s part of a Group isn’t listed in the group’s help message, but
+// it can still be run.
+//
+// Stdout and Stderr are used for the help message and error messages, respectively, and Columns
+// sets the width of the help message. If they’re left at their zero values, a command that’s part
+// of a Group uses the group’s settings; otherwise, it uses os.Stdout, os.Stderr and the width of
+// the terminal.
+//
+// By default, flags can appear anywhere on the command-line, before, between or after positional
+// arguments. Set StrictOrder to require flags to come before all positional arguments. In both
+// cases, “--” ends the list of flags, so arguments after it are positional even if they start
+// with a hyphen.
 type Cmd struct {
 	Flags
 	Summary, Details string
+	StrictOrder      bool
+	Hidden           bool
+	Stdout, Stderr   io.Writer
+	Columns          int
 	name             string
-	f                func()
+	parent           *Group
+	f                func(ctx context.Context) error
+	withContext      bool
 	args             []arg
 	argsState        int
+	configPath       string
+	config           *config
 }
 
 type arg struct {
 	name     string
+	usage    string
 	optional bool
-	single   *string
-	multi    *[]string
+	single   func(name, value string) error
+	multi    func(name string, values []string) error
 }
 
 const (
@@ -47,63 +73,135 @@ const (
 // New returns a new command that calls the given function after parsing arguments. The name is used
 // in help and error messages.
 func New(name string, f func()) *Cmd {
+	return newCmd(name, func(ctx context.Context) error {
+		f()
+		return nil
+	}, false)
+}
+
+// NewContext returns a new command like New, but the function gets a context and can return an
+// error. When the command is started with Run, the context is cancelled if the program receives
+// SIGINT or SIGTERM, and an error returned by the function is printed before the program exits
+// with status 1. After the first signal, a second one ends the program as usual, even if the
+// function ignores the context.
+func NewContext(name string, f func(ctx context.Context) error) *Cmd {
+	return newCmd(name, f, true)
+}
+
+func newCmd(name string, f func(ctx context.Context) error, withContext bool) *Cmd {
 	return &Cmd{
-		Flags: newFlags(),
-		name:  name,
-		f:     f,
+		Flags:       newFlags(),
+		name:        name,
+		f:           f,
+		withContext: withContext,
 	}
 }
 
+// ConfigFile sets a configuration file to read option values from. Values in the file override
+// defaults, but environment variables (see Flags.Env) and the command-line override values in the
+// file. It’s not an error if the file doesn’t exist.
+//
+// Files ending in .json should contain a JSON object; all other files are read as INI files with
+// “key = value” lines. Keys are the long names of flags without the leading hyphens, for example
+// “max-size” for “--max-size”.
+func (c *Cmd) ConfigFile(path string) {
+	c.configPath = path
+}
+
 func ambiguousArgs() {
 	panic("Cmd: ambiguous sequence of positional arguments")
 }
 
 // Arg defines a positional argument.
 func (c *Cmd) Arg(name string, p *string) {
-	switch c.argsState {
-	case argsInitial, argsRegular:
-		c.argsState = argsRegular
-	case argsMulti:
-		c.argsState = argsMultiRegular
-	case argsOptinal:
-		c.argsState = argsOptinalRegular
-	default:
-		ambiguousArgs()
-	}
-	c.args = append(c.args, arg{
-		name:   name,
-		single: p,
-	})
+	Arg(c, name, p, parseString)
 }
 
 // OptionalArg defines an optional positional argument.
 func (c *Cmd) OptionalArg(name string, p *string) {
-	switch c.argsState {
-	case argsInitial, argsOptinal:
-		c.argsState = argsOptinal
-	case argsRegular:
-		c.argsState = argsRegularOptional
-	default:
-		ambiguousArgs()
+	OptionalArg(c, name, p, parseString)
+}
+
+// IntArg defines a positional argument with an integer value. For optional or repeated arguments of
+// this or other types, use the generic functions OptionalArg, RepeatedArg and OptionalRepeatedArg.
+func (c *Cmd) IntArg(name string, p *int) {
+	Arg(c, name, p, strconv.Atoi)
+}
+
+// FloatArg defines a positional argument with a float64 value. See strconv.ParseFloat for the
+// format it recognizes.
+func (c *Cmd) FloatArg(name string, p *float64) {
+	Arg(c, name, p, parseFloat)
+}
+
+// DurationArg defines a positional argument with a time.Duration value. See time.ParseDuration
+// for the format it recognizes.
+func (c *Cmd) DurationArg(name string, p *time.Duration) {
+	Arg(c, name, p, time.ParseDuration)
+}
+
+// MetricArg defines a positional argument with an integer value that allows metric suffixes, like
+// Flags.Metric.
+func (c *Cmd) MetricArg(name string, p *int) {
+	Arg(c, name, p, parseMetric)
+}
+
+// BytesArg defines a positional argument with an integer value that allows binary suffixes, like
+// Flags.Bytes.
+func (c *Cmd) BytesArg(name string, p *int) {
+	Arg(c, name, p, parseBytes)
+}
+
+// VarArg defines a positional argument with a user-defined type.
+func (c *Cmd) VarArg(name string, v Value) {
+	c.addArg(name, false, setValue(v))
+}
+
+// OptionalVarArg defines an optional positional argument with a user-defined type.
+func (c *Cmd) OptionalVarArg(name string, v Value) {
+	c.addArg(name, true, setValue(v))
+}
+
+func (c *Cmd) addArg(name string, optional bool, set func(name, value string) error) {
+	if optional {
+		switch c.argsState {
+		case argsInitial, argsOptinal:
+			c.argsState = argsOptinal
+		case argsRegular:
+			c.argsState = argsRegularOptional
+		default:
+			ambiguousArgs()
+		}
+	} else {
+		switch c.argsState {
+		case argsInitial, argsRegular:
+			c.argsState = argsRegular
+		case argsMulti:
+			c.argsState = argsMultiRegular
+		case argsOptinal:
+			c.argsState = argsOptinalRegular
+		default:
+			ambiguousArgs()
+		}
 	}
 	c.args = append(c.args, arg{
 		name:     name,
-		optional: true,
-		single:   p,
+		optional: optional,
+		single:   set,
 	})
 }
 
 // RepeatedArg defines an argument that can be present one or more times.
 func (c *Cmd) RepeatedArg(name string, p *[]string) {
-	c.addArgs(name, p, false)
+	RepeatedArg(c, name, p, parseString)
 }
 
 // OptionalRepeatedArg defines an argument that can be present zero or more times.
 func (c *Cmd) OptionalRepeatedArg(name string, p *[]string) {
-	c.addArgs(name, p, true)
+	OptionalRepeatedArg(c, name, p, parseString)
 }
 
-func (c *Cmd) addArgs(name string, p *[]string, optional bool) {
+func (c *Cmd) addArgs(name string, optional bool, set func(name string, values []string) error) {
 	switch c.argsState {
 	case argsInitial:
 		c.argsState = argsMulti
@@ -115,31 +213,102 @@ func (c *Cmd) addArgs(name string, p *[]string, optional bool) {
 	c.args = append(c.args, arg{
 		name:     name,
 		optional: optional,
-		multi:    p,
+		multi:    set,
 	})
 }
 
-func (c *Cmd) errorAndExit(err error) {
-	w := os.Stderr
-	fmt.Fprintf(w, "%s: %s\n", c.name, err)
-	fmt.Fprintf(w, "Try '%s --help' for more information.\n", c.name)
-	os.Exit(2)
+func (c *Cmd) usageError(err error) error {
+	return &UsageError{
+		Name: c.name,
+		Err:  err,
+		help: c.name + " --help",
+	}
 }
 
-func (c *Cmd) helpAndExit() {
-	fmt.Fprintf(os.Stdout, c.Help())
-	os.Exit(0)
+func (c *Cmd) printHelp() error {
+	fmt.Fprint(c.stdout(), c.Help())
+	return ErrHelp
+}
+
+// ArgUsage sets a description for the positional argument with the given name. If at least one
+// argument has a description, the help message lists the arguments in an “Arguments” section.
+func (c *Cmd) ArgUsage(name, usage string) {
+	for i := range c.args {
+		if c.args[i].name == name {
+			c.args[i].usage = usage
+			return
+		}
+	}
+	panic(fmt.Sprintf("Cmd: no argument %s", name))
 }
 
 // Help returns a help message.
 func (c *Cmd) Help() string {
 	defs := []*definitionList{
+		{
+			title:       "Arguments",
+			definitions: c.argDefinitions(),
+		},
 		{
 			title:       "Options",
-			definitions: c.Flags.defs,
+			definitions: c.Flags.definitions(),
 		},
+		{
+			title:       "Global options",
+			definitions: c.Flags.globalDefinitions(),
+		},
+	}
+	return formatHelp(c.columns(), c.usage(), c.Summary, c.Details, defs)
+}
+
+func (c *Cmd) stdout() io.Writer {
+	if c.Stdout != nil {
+		return c.Stdout
+	}
+	if c.parent != nil {
+		return c.parent.stdout()
 	}
-	return formatHelp(c.usage(), c.Summary, c.Details, defs)
+	return os.Stdout
+}
+
+func (c *Cmd) stderr() io.Writer {
+	if c.Stderr != nil {
+		return c.Stderr
+	}
+	if c.parent != nil {
+		return c.parent.stderr()
+	}
+	return os.Stderr
+}
+
+func (c *Cmd) columns() int {
+	if c.Columns != 0 {
+		return c.Columns
+	}
+	if c.parent != nil {
+		return c.parent.columns()
+	}
+	return terminalColumns()
+}
+
+// argDefinitions returns definitions for the positional arguments, or none if no argument has a
+// description.
+func (c *Cmd) argDefinitions() []*definition {
+	defs := []*definition{}
+	described := false
+	for _, a := range c.args {
+		defs = append(defs, &definition{
+			terms: []string{a.name},
+			text:  a.usage,
+		})
+		if a.usage != "" {
+			described = true
+		}
+	}
+	if !described {
+		return nil
+	}
+	return defs
 }
 
 func (c *Cmd) usage() string {
@@ -163,24 +332,88 @@ func (c *Cmd) usage() string {
 }
 
 // Run parses the given command-line arguments, sets values for given flags and runs the function
-// provided to New. It’s usually called with os.Args[1:].
+// provided to New or NewContext. It’s usually called with os.Args[1:].
+//
+// If the user asks for help, Run prints the help message and exits. If the command-line is invalid,
+// it prints an error message and exits with status 2. See NewContext for functions that return an
+// error.
 func (c *Cmd) Run(args []string) {
+	exit(c.stderr(), c.execute(context.Background(), args, true))
+}
+
+// Execute is like Run, but it returns an error instead of exiting the program. If the user asks for
+// help, it prints the help message and returns ErrHelp. If the command-line is invalid, it returns
+// a *UsageError. If the function returns an error, it returns a *CommandError.
+func (c *Cmd) Execute(args []string) error {
+	return c.ExecuteContext(context.Background(), args)
+}
+
+// ExecuteContext is like Execute, but passes the given context to a function provided to
+// NewContext.
+func (c *Cmd) ExecuteContext(ctx context.Context, args []string) error {
+	return c.execute(ctx, args, false)
+}
+
+// execute runs the command. If signals is true and the command was created with NewContext, the
+// context is cancelled when the program receives SIGINT or SIGTERM.
+func (c *Cmd) execute(ctx context.Context, args []string, signals bool) error {
 	help, err := c.parse(args)
 	if err != nil {
-		c.errorAndExit(err)
+		return c.usageError(err)
 	}
 	if help {
-		c.helpAndExit()
+		return c.printHelp()
+	}
+	if signals && c.withContext {
+		var stop context.CancelFunc
+		ctx, stop = signalContext(ctx)
+		defer stop()
+	}
+	err = c.f(ctx)
+	if err != nil {
+		return &CommandError{
+			Name: c.name,
+			Err:  err,
+		}
 	}
-	c.f()
+	return nil
 }
 
 func (c *Cmd) parse(args []string) (help bool, err error) {
 	// parse flags
-	help, args, err = c.Flags.parse(args)
+	help, args, err = c.Flags.parse(args, !c.StrictOrder)
 	if err != nil || help {
 		return help, err
 	}
+	if c.parent != nil {
+		err = c.parent.finish()
+		if err != nil {
+			return false, err
+		}
+	}
+	err = c.Flags.applyEnv()
+	if err != nil {
+		return false, err
+	}
+	conf := c.config
+	if c.configPath != "" {
+		conf, err = readConfig(c.configPath)
+		if err != nil {
+			return false, err
+		}
+	}
+	err = c.Flags.applyConfig(conf)
+	if err != nil {
+		return false, err
+	}
+	err = conf.checkSections(&c.Flags, nil)
+	if err != nil {
+		return false, err
+	}
+	err = c.Flags.check()
+	if err != nil {
+		return false, err
+	}
 
 	if c.argsState >= argsMulti {
 		// parse positional arguments in reverse order
@@ -193,15 +426,15 @@ func (c *Cmd) parse(args []string) (help bool, err error) {
 				return false, nil
 			}
 			if a.single != nil {
-				*a.single = args[len(args)-1]
+				err = a.single(a.name, args[len(args)-1])
 				args = args[:len(args)-1]
 			} else {
-				*a.multi = make([]string, len(args))
-				for i, arg := range args {
-					(*a.multi)[i] = arg
-				}
+				err = a.multi(a.name, args)
 				args = nil
 			}
+			if err != nil {
+				return false, err
+			}
 		}
 	} else {
 		// parse positional arguments in-order
@@ -213,15 +446,15 @@ func (c *Cmd) parse(args []string) (help bool, err error) {
 				return false, nil
 			}
 			if a.single != nil {
-				*a.single = args[0]
+				err = a.single(a.name, args[0])
 				args = args[1:]
 			} else {
-				*a.multi = make([]string, len(args))
-				for i, arg := range args {
-					(*a.multi)[i] = arg
-				}
+				err = a.multi(a.name, args)
 				args = nil
 			}
+			if err != nil {
+				return false, err
+			}
 		}
 	}
 
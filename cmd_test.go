@@ -1,8 +1,16 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
 	"reflect"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestCmdUsage(t *testing.T) {
@@ -158,3 +166,314 @@ func TestOptionalArgs(t *testing.T) {
 		}
 	}
 }
+
+func TestInterleavedArgs(t *testing.T) {
+	var verbose bool
+	var files []string
+	command := New("command", func() {})
+	command.Flag("-v", &verbose, "")
+	command.RepeatedArg("FILE", &files)
+	cases := []struct {
+		args        []string
+		strict      bool
+		wantError   bool
+		wantVerbose bool
+		wantFiles   []string
+	}{
+		{
+			args:        []string{"a", "-v", "b"},
+			wantVerbose: true,
+			wantFiles:   []string{"a", "b"},
+		},
+		{
+			args:      []string{"-", "--", "-v", "-foo"},
+			wantFiles: []string{"-", "-v", "-foo"},
+		},
+		{
+			args:      []string{"a", "-v"},
+			strict:    true,
+			wantFiles: []string{"a", "-v"},
+		},
+		{
+			args:        []string{"-v", "--", "-foo"},
+			strict:      true,
+			wantVerbose: true,
+			wantFiles:   []string{"-foo"},
+		},
+	}
+	for _, c := range cases {
+		verbose, files = false, nil
+		command.StrictOrder = c.strict
+		_, err := command.parse(c.args)
+		if (err != nil) != c.wantError {
+			t.Errorf("parse(%v) returned error %v", c.args, err)
+			continue
+		}
+		if c.wantError {
+			continue
+		}
+		if verbose != c.wantVerbose || !reflect.DeepEqual(files, c.wantFiles) {
+			t.Errorf("parse(%v) set verbose, files to %v, %v, want %v, %v",
+				c.args, verbose, files, c.wantVerbose, c.wantFiles)
+		}
+	}
+}
+
+func TestRequired(t *testing.T) {
+	var host, db string
+	var port int
+	command := New("connect", func() {})
+	command.String("-H --host", &host, "HOST", "")
+	command.Int("-p --port", &port, "PORT", "")
+	command.Required("-H")
+	command.Arg("DB", &db)
+
+	want := "Usage: connect [OPTION] --host HOST DB"
+	if got := command.usage(); got != want {
+		t.Errorf("usage == `%s`, want `%s`", got, want)
+	}
+
+	_, err := command.parse([]string{"-p", "5432", "mydb"})
+	wantError := "missing --host option"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+
+	_, err = command.parse([]string{"--host", "localhost", "mydb"})
+	if err != nil {
+		t.Errorf("parse returned error %v", err)
+	}
+
+	help, err := command.parse([]string{"--help"})
+	if err != nil || !help {
+		t.Errorf("parse(--help) returned %v, %v, want true, nil", help, err)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	var (
+		port    int
+		size    int
+		debug   bool
+		verbose int
+	)
+	command := New("server", func() {})
+	command.Int("-p --port", &port, "PORT", "")
+	command.Env("--port", "TEST_PORT")
+	command.Bytes("--max-size", &size, "SIZE", "")
+	command.Env("--max-size", "TEST_MAX_SIZE")
+	command.Flag("--debug", &debug, "")
+	command.Env("--debug", "TEST_DEBUG")
+	command.Count("-v", &verbose, "")
+	command.Env("-v", "TEST_VERBOSE")
+	os.Setenv("TEST_PORT", "8080")
+	os.Setenv("TEST_MAX_SIZE", "2k")
+	os.Setenv("TEST_DEBUG", "true")
+	os.Setenv("TEST_VERBOSE", "2")
+	defer func() {
+		for _, v := range []string{"TEST_PORT", "TEST_MAX_SIZE", "TEST_DEBUG", "TEST_VERBOSE"} {
+			os.Unsetenv(v)
+		}
+	}()
+
+	_, err := command.parse([]string{"--port", "9090"})
+	if err != nil {
+		t.Fatalf("parse returned error %v", err)
+	}
+	if port != 9090 || size != 2048 || !debug || verbose != 2 {
+		t.Errorf("parse set port, size, debug, verbose to %v, %v, %v, %v, want %v, %v, %v, %v",
+			port, size, debug, verbose, 9090, 2048, true, 2)
+	}
+
+	os.Setenv("TEST_PORT", "http")
+	_, err = command.parse(nil)
+	wantError := "invalid $TEST_PORT argument 'http'"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+
+	want := "(env: TEST_PORT)"
+	if got := command.definitions()[0].text; got != want {
+		t.Errorf("definition text == `%v`, want `%v`", got, want)
+	}
+}
+
+func TestTypedArgs(t *testing.T) {
+	var (
+		count   int
+		size    int
+		timeout time.Duration
+		ratio   float64
+		rate    int
+		level   logLevel
+		files   []string
+	)
+	command := New("command", func() {})
+	command.IntArg("COUNT", &count)
+	command.BytesArg("SIZE", &size)
+	command.DurationArg("TIMEOUT", &timeout)
+	command.FloatArg("RATIO", &ratio)
+	command.MetricArg("RATE", &rate)
+	command.VarArg("LEVEL", &level)
+	command.OptionalRepeatedArg("FILE", &files)
+
+	_, err := command.parse([]string{"3", "4k", "5s", "0.5", "2k", "error", "a", "b"})
+	if err != nil {
+		t.Fatalf("parse returned error %v", err)
+	}
+	if count != 3 || size != 4096 || timeout != 5*time.Second || level != 3 {
+		t.Errorf("parse set count, size, timeout, level = %v, %v, %v, %v, want %v, %v, %v, %v",
+			count, size, timeout, level, 3, 4096, 5*time.Second, 3)
+	}
+	if ratio != 0.5 || rate != 2000 {
+		t.Errorf("parse set ratio, rate = %v, %v, want %v, %v", ratio, rate, 0.5, 2000)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("parse set files = %v, want %v", files, want)
+	}
+
+	_, err = command.parse([]string{"x", "4k", "5s", "0.5", "2k", "error"})
+	wantError := "invalid COUNT argument 'x'"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+
+	ambiguousArgsTest(t, func(c *Cmd) {
+		c.OptionalVarArg("LEVEL", &level)
+		c.IntArg("COUNT", &count)
+		c.OptionalArg("NAME", new(string))
+	})
+}
+
+func TestCmdHelp(t *testing.T) {
+	os.Setenv("COLUMNS", "80")
+	defer os.Unsetenv("COLUMNS")
+	command := New("cp", func() {})
+	command.Flag("-f --force", new(bool), "overwrite existing files")
+	command.RepeatedArg("SOURCE", new([]string))
+	command.Arg("DEST", new(string))
+
+	want := `Usage: cp [OPTION] SOURCE... DEST
+
+Options:
+  -f, --force  overwrite existing files
+`
+	if got := command.Help(); got != want {
+		t.Errorf("Help() == `%s`, want `%s`", got, want)
+	}
+
+	command.ArgUsage("SOURCE", "files to copy")
+	command.ArgUsage("DEST", "target file or directory")
+	want = `Usage: cp [OPTION] SOURCE... DEST
+
+Arguments:
+  SOURCE  files to copy
+  DEST    target file or directory
+
+Options:
+  -f, --force  overwrite existing files
+`
+	if got := command.Help(); got != want {
+		t.Errorf("Help() == `%s`, want `%s`", got, want)
+	}
+}
+
+type contextKey struct{}
+
+func TestExecuteContext(t *testing.T) {
+	failure := errors.New("connection refused")
+	var got interface{}
+	command := NewContext("connect", func(ctx context.Context) error {
+		got = ctx.Value(contextKey{})
+		return failure
+	})
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+	err := command.ExecuteContext(ctx, nil)
+	if got != "value" {
+		t.Errorf("ExecuteContext didn't pass context to function")
+	}
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) || !errors.Is(err, failure) {
+		t.Errorf("ExecuteContext returned %v, want a *CommandError wrapping %v", err, failure)
+	}
+	want := "connect: connection refused"
+	if err.Error() != want {
+		t.Errorf("ExecuteContext returned error `%v`, want `%v`", err, want)
+	}
+
+	err = command.Execute([]string{"extra"})
+	var usageErr *UsageError
+	if !errors.As(err, &usageErr) {
+		t.Errorf("Execute returned %v, want a *UsageError", err)
+	}
+}
+
+// runSignalsHelper is run in a child process by TestRunSignals. It prints “ready” once the
+// command’s function has started.
+func runSignalsHelper(mode string) {
+	switch mode {
+	case "plain":
+		New("sleep", func() {
+			fmt.Println("ready")
+			time.Sleep(5 * time.Second)
+		}).Run(nil)
+	case "context":
+		NewContext("wait", func(ctx context.Context) error {
+			fmt.Println("ready")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+				return nil
+			}
+		}).Run(nil)
+	case "ignore":
+		NewContext("sleep", func(ctx context.Context) error {
+			fmt.Println("ready")
+			time.Sleep(5 * time.Second)
+			return nil
+		}).Run(nil)
+	}
+	os.Exit(0)
+}
+
+func TestRunSignals(t *testing.T) {
+	if mode := os.Getenv("CMD_TEST_SIGNALS"); mode != "" {
+		runSignalsHelper(mode)
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("can't send SIGINT on Windows")
+	}
+
+	cases := []struct {
+		mode     string
+		signals  int
+		exitCode int // -1 if the process should be killed by the signal
+	}{
+		{"plain", 1, -1},
+		{"context", 1, 1},
+		{"ignore", 2, -1},
+	}
+	for _, c := range cases {
+		child := exec.Command(os.Args[0], "-test.run=^TestRunSignals$")
+		child.Env = append(os.Environ(), "CMD_TEST_SIGNALS="+c.mode)
+		stdout, err := child.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = child.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bufio.NewReader(stdout).ReadString('\n')
+		for i := 0; i < c.signals; i++ {
+			time.Sleep(100 * time.Millisecond)
+			child.Process.Signal(os.Interrupt)
+		}
+		child.Wait()
+		if got := child.ProcessState.ExitCode(); got != c.exitCode {
+			t.Errorf("%s: child exited with %v, want %v", c.mode, got, c.exitCode)
+		}
+	}
+}
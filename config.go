@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A config holds the values read from a configuration file. The values for a sub-command or
+// sub-group are in a section with its name; line is where the section starts.
+type config struct {
+	path     string
+	line     int
+	values   map[string][]configValue
+	sections map[string]*config
+}
+
+// A configValue is a value from a configuration file, with the line it was found on.
+type configValue struct {
+	value string
+	line  int
+}
+
+func newConfig(path string) *config {
+	return &config{
+		path:     path,
+		values:   make(map[string][]configValue),
+		sections: make(map[string]*config),
+	}
+}
+
+// section returns the section with the given name, or nil if there’s none.
+func (c *config) section(name string) *config {
+	if c == nil {
+		return nil
+	}
+	return c.sections[name]
+}
+
+// readConfig reads a configuration file. Files ending in .json are parsed as JSON, all others as
+// INI files. It returns nil if the file doesn’t exist.
+func readConfig(path string) (*config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".json" {
+		return parseJSON(path, data)
+	}
+	return parseINI(path, data)
+}
+
+// parseINI parses an INI file with “key = value” lines. Lines starting with “;” or “#” are
+// comments. A “[name]” line starts the section for a sub-command or sub-group; use dots for nested
+// groups, as in “[remote.add]”. A key can be repeated to give more than one value.
+func parseINI(path string, data []byte) (*config, error) {
+	root := newConfig(path)
+	current := root
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == ';' || text[0] == '#' {
+			continue
+		}
+
+		if text[0] == '[' {
+			if text[len(text)-1] != ']' {
+				return nil, fmt.Errorf("%s:%d: invalid section header", path, line)
+			}
+			current = root
+			for _, name := range strings.Split(text[1:len(text)-1], ".") {
+				name = strings.TrimSpace(name)
+				if current.sections[name] == nil {
+					current.sections[name] = newConfig(path)
+					current.sections[name].line = line
+				}
+				current = current.sections[name]
+			}
+			continue
+		}
+
+		kv := strings.SplitN(text, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, line)
+		}
+		value := strings.TrimSpace(kv[1])
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		current.values[key] = append(current.values[key], configValue{value, line})
+	}
+	return root, scanner.Err()
+}
+
+// parseJSON parses a JSON file containing an object. Nested objects are the sections for
+// sub-commands and sub-groups, arrays give more than one value for a key.
+func parseJSON(path string, data []byte) (*config, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	line := func() int {
+		return 1 + bytes.Count(data[:d.InputOffset()], []byte("\n"))
+	}
+	fail := func(err error) (*config, error) {
+		return nil, fmt.Errorf("%s:%d: %v", path, line(), err)
+	}
+
+	t, err := d.Token()
+	if err != nil {
+		return fail(err)
+	}
+	if t != json.Delim('{') {
+		return fail(fmt.Errorf("expected an object"))
+	}
+	c := newConfig(path)
+	err = parseJSONObject(d, c, line)
+	if err != nil {
+		return fail(err)
+	}
+	return c, nil
+}
+
+// parseJSONObject parses the contents of a JSON object after the opening brace.
+func parseJSONObject(d *json.Decoder, c *config, line func() int) error {
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		key := t.(string)
+		keyLine := line()
+
+		t, err = d.Token()
+		if err != nil {
+			return err
+		}
+		switch t {
+		case json.Delim('{'):
+			section := newConfig(c.path)
+			section.line = keyLine
+			err := parseJSONObject(d, section, line)
+			if err != nil {
+				return err
+			}
+			c.sections[key] = section
+		case json.Delim('['):
+			for d.More() {
+				t, err := d.Token()
+				if err != nil {
+					return err
+				}
+				value, ok := jsonValue(t)
+				if !ok {
+					return fmt.Errorf("invalid value for %s", key)
+				}
+				c.values[key] = append(c.values[key], configValue{value, keyLine})
+			}
+			_, err := d.Token()
+			if err != nil {
+				return err
+			}
+		case nil:
+		default:
+			value, ok := jsonValue(t)
+			if !ok {
+				return fmt.Errorf("invalid value for %s", key)
+			}
+			c.values[key] = append(c.values[key], configValue{value, keyLine})
+		}
+	}
+	_, err := d.Token()
+	return err
+}
+
+// jsonValue converts a JSON string, number or boolean to a string.
+func jsonValue(t json.Token) (string, bool) {
+	switch v := t.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// checkSections returns an error if the configuration has a section that isn’t for one of the
+// given sub-commands or sub-groups. In a JSON file, that includes an object as a flag’s value.
+func (c *config) checkSections(f *Flags, names map[string]bool) error {
+	if c == nil {
+		return nil
+	}
+	keys := []string{}
+	for key := range c.sections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	options := f.configOptions()
+	for _, key := range keys {
+		if names[key] {
+			continue
+		}
+		line := c.sections[key].line
+		if _, ok := options[key]; ok {
+			return fmt.Errorf("%s:%d: invalid value for %s", c.path, line, key)
+		}
+		return fmt.Errorf("%s:%d: unknown section '%s'", c.path, line, key)
+	}
+	return nil
+}
+
+// configOptions returns the options that can be set in a configuration file by their keys.
+func (f *Flags) configOptions() map[string]*option {
+	options := make(map[string]*option)
+	for _, o := range f.list {
+		for _, name := range o.names {
+			key := strings.TrimLeft(name, "-")
+			if len([]rune(key)) > 1 {
+				options[key] = o
+			}
+		}
+	}
+	return options
+}
+
+// applyConfig sets values from a configuration file for flags that weren’t set on the command-line
+// or through environment variables, skipping flags that are mutually exclusive with one that was.
+// Keys are the flag’s long names without leading hyphens.
+func (f *Flags) applyConfig(c *config) error {
+	if c == nil {
+		return nil
+	}
+	options := f.configOptions()
+
+	keys := []string{}
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := c.values[key]
+		o, ok := options[key]
+		if !ok {
+			return fmt.Errorf("%s:%d: unknown key '%s'", c.path, values[0].line, key)
+		}
+		if o.seen || f.excluded(o, fromConfig) {
+			continue
+		}
+		o.source = fromConfig
+		for _, v := range values {
+			err := o.apply(key, v.value)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", c.path, v.line, err)
+			}
+		}
+	}
+	return nil
+}
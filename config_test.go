@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseINI(t *testing.T) {
+	data := `
+; comment
+port = 8080
+include = a
+include = "b c"
+
+[remote.add]
+# comment
+fetch = true
+`
+	got, err := parseINI("test.ini", []byte(data))
+	if err != nil {
+		t.Fatalf("parseINI returned error %v", err)
+	}
+	want := newConfig("test.ini")
+	want.values["port"] = []configValue{{"8080", 3}}
+	want.values["include"] = []configValue{{"a", 4}, {"b c", 5}}
+	remote := newConfig("test.ini")
+	remote.line = 7
+	add := newConfig("test.ini")
+	add.line = 7
+	add.values["fetch"] = []configValue{{"true", 9}}
+	remote.sections["add"] = add
+	want.sections["remote"] = remote
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseINI returned %v, want %v", got, want)
+	}
+
+	_, err = parseINI("test.ini", []byte("port 8080"))
+	wantError := "test.ini:1: expected key = value"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parseINI returned error %v, want %v", err, wantError)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	data := `{
+  "port": 8080,
+  "include": ["a", "b c"],
+  "remote": {
+    "add": {
+      "fetch": true
+    }
+  },
+  "unset": null
+}`
+	got, err := parseJSON("test.json", []byte(data))
+	if err != nil {
+		t.Fatalf("parseJSON returned error %v", err)
+	}
+	want := newConfig("test.json")
+	want.values["port"] = []configValue{{"8080", 2}}
+	want.values["include"] = []configValue{{"a", 3}, {"b c", 3}}
+	remote := newConfig("test.json")
+	remote.line = 4
+	add := newConfig("test.json")
+	add.line = 5
+	add.values["fetch"] = []configValue{{"true", 6}}
+	remote.sections["add"] = add
+	want.sections["remote"] = remote
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseJSON returned %v, want %v", got, want)
+	}
+
+	_, err = parseJSON("test.json", []byte("[1, 2]"))
+	if err == nil {
+		t.Errorf("parseJSON didn't return error for an array")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	var (
+		host    string
+		port    int
+		verbose bool
+	)
+	f := newFlags()
+	f.String("-H --host", &host, "HOST", "")
+	f.Int("-p --port", &port, "PORT", "")
+	f.Flag("-v", &verbose, "")
+
+	c := newConfig("test.ini")
+	c.values["host"] = []configValue{{"example.com", 1}}
+	c.values["port"] = []configValue{{"8080", 2}}
+	_, _, err := f.parse([]string{"--port", "9090"}, false)
+	if err == nil {
+		err = f.applyConfig(c)
+	}
+	if err != nil {
+		t.Fatalf("applyConfig returned error %v", err)
+	}
+	if host != "example.com" || port != 9090 {
+		t.Errorf("applyConfig set host, port = %v, %v, want %v, %v",
+			host, port, "example.com", 9090)
+	}
+
+	c.values["port"] = []configValue{{"http", 2}}
+	f.reset()
+	err = f.applyConfig(c)
+	wantError := "test.ini:2: invalid port argument 'http'"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("applyConfig returned error %v, want %v", err, wantError)
+	}
+
+	c = newConfig("test.ini")
+	c.values["v"] = []configValue{{"true", 3}}
+	err = f.applyConfig(c)
+	wantError = "test.ini:3: unknown key 'v'"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("applyConfig returned error %v, want %v", err, wantError)
+	}
+}
+
+func TestGroupConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "service.ini")
+	data := "verbose = true\n[check.database]\nhost = db.example.com\nport = 5432\n"
+	err = ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		verbose bool
+		host    string
+		port    int
+	)
+	g := NewGroup("service")
+	g.ConfigFile(path)
+	g.Flag("-v --verbose", &verbose, "")
+	check := g.Group("check")
+	database := check.Command("database", func() {})
+	database.String("--host", &host, "HOST", "")
+	database.Int("--port", &port, "PORT", "")
+	database.Env("--port", "TEST_DATABASE_PORT")
+	os.Setenv("TEST_DATABASE_PORT", "6543")
+	defer os.Unsetenv("TEST_DATABASE_PORT")
+
+	g.Execute([]string{"check", "database", "--host", "localhost"})
+	if !verbose || host != "localhost" || port != 6543 {
+		t.Errorf("Group.run set verbose, host, port = %v, %v, %v, want %v, %v, %v",
+			verbose, host, port, true, "localhost", 6543)
+	}
+}
+
+func TestConstraintsWithConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.ini")
+	err = ioutil.WriteFile(path, []byte("json = true\npassword = secret\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var json, table bool
+	command := New("report", func() {})
+	command.ConfigFile(path)
+	command.Flag("--json", &json, "")
+	command.Flag("--table", &table, "")
+	command.String("-u --user", new(string), "USER", "")
+	command.String("-p --password", new(string), "PASSWORD", "")
+	command.MutuallyExclusive("--json", "--table")
+	command.RequiredTogether("--user", "--password")
+
+	cases := []struct {
+		args                []string
+		wantError           string
+		wantJSON, wantTable bool
+	}{
+		{[]string{"--table", "-u", "me"}, "", false, true},
+		{[]string{"-u", "me"}, "", true, false},
+		{[]string{}, "--password requires --user", true, false},
+		{[]string{"--json", "--table", "-u", "me"}, "--json and --table can't be used together",
+			true, true},
+	}
+	for _, c := range cases {
+		json, table = false, false
+		_, err := command.parse(c.args)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.wantError {
+			t.Errorf("parsing %v returned error `%v`, want `%v`", c.args, got, c.wantError)
+		}
+		if json != c.wantJSON || table != c.wantTable {
+			t.Errorf("parsing %v set json, table = %v, %v, want %v, %v",
+				c.args, json, table, c.wantJSON, c.wantTable)
+		}
+	}
+}
+
+func TestUnknownSections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		file, data string
+		wantError  string
+	}{
+		{"a.ini", "dir = /srv\n[statsu]\nshort = true\n", "2: unknown section 'statsu'"},
+		{"b.json", "{\n\"dir\": {\"x\": 1}\n}", "2: invalid value for dir"},
+		{"c.ini", "[status]\nshort = true\n[status.x]\n", "3: unknown section 'x'"},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, c.file)
+		err = ioutil.WriteFile(path, []byte(c.data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := NewGroup("git")
+		g.ConfigFile(path)
+		g.String("--dir", new(string), "DIR", "")
+		g.Command("status", func() {}).Flag("--short", new(bool), "")
+
+		err = g.Execute([]string{"status"})
+		wantError := path + ":" + c.wantError
+		var usageErr *UsageError
+		if !errors.As(err, &usageErr) || usageErr.Err.Error() != wantError {
+			t.Errorf("Execute with %s returned %v, want %v", c.file, err, wantError)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A constraint describes a relationship between flags that’s checked after parsing.
+type constraint struct {
+	kind    int
+	options []*option
+}
+
+const (
+	mutuallyExclusive = iota
+	requiredTogether
+	oneRequired
+)
+
+// MutuallyExclusive declares that at most one of the flags with the given names can be used. The
+// command-line overrides environment variables, which override the configuration file: if one of
+// the flags has a value from one of these sources, values for the others from sources with lower
+// precedence are ignored. Values from the same source conflict.
+func (f *Flags) MutuallyExclusive(names ...string) {
+	c := f.addConstraint(mutuallyExclusive, names)
+	for _, o := range c.options {
+		o.notes = append(o.notes, "can't be used with "+joinNames(c.others(o), "or"))
+	}
+}
+
+// RequiredTogether declares that the flags with the given names must be used together: if one of
+// them has a value, from the command-line, an environment variable or a configuration file, all of
+// them need one.
+func (f *Flags) RequiredTogether(names ...string) {
+	c := f.addConstraint(requiredTogether, names)
+	for _, o := range c.options {
+		o.notes = append(o.notes, "requires "+joinNames(c.others(o), "and"))
+	}
+}
+
+// OneRequired declares that at least one of the flags with the given names must be used. A value
+// from an environment variable or a configuration file counts.
+func (f *Flags) OneRequired(names ...string) {
+	c := f.addConstraint(oneRequired, names)
+	for _, o := range c.options {
+		o.notes = append(o.notes, fmt.Sprintf("required unless %s is given",
+			joinNames(c.others(o), "or")))
+	}
+}
+
+func (f *Flags) addConstraint(kind int, names []string) *constraint {
+	if len(names) < 2 {
+		panic("Flags: a constraint needs at least two flags")
+	}
+	c := &constraint{
+		kind: kind,
+	}
+	for _, name := range names {
+		c.options = append(c.options, f.lookup(name))
+	}
+	f.constraints = append(f.constraints, c)
+	return c
+}
+
+// others returns the options in the constraint except o.
+func (c *constraint) others(o *option) []*option {
+	result := []*option{}
+	for _, other := range c.options {
+		if other != o {
+			result = append(result, other)
+		}
+	}
+	return result
+}
+
+// check returns an error if the constraint is violated.
+func (c *constraint) check() error {
+	seen, missing := []*option{}, []*option{}
+	for _, o := range c.options {
+		if o.seen {
+			seen = append(seen, o)
+		} else {
+			missing = append(missing, o)
+		}
+	}
+	switch c.kind {
+	case mutuallyExclusive:
+		if len(seen) > 1 {
+			return fmt.Errorf("%s and %s can't be used together", seen[0].name(), seen[1].name())
+		}
+	case requiredTogether:
+		if len(seen) > 0 && len(missing) > 0 {
+			return fmt.Errorf("%s requires %s", seen[0].name(), missing[0].name())
+		}
+	case oneRequired:
+		if len(seen) == 0 {
+			return fmt.Errorf("missing %s option", joinNames(c.options, "or"))
+		}
+	}
+	return nil
+}
+
+// excluded returns true if o is mutually exclusive with an option that has a value from a source
+// with higher precedence than the given one, so a value for o from that source should be ignored.
+func (f *Flags) excluded(o *option, source int) bool {
+	for _, c := range f.constraints {
+		if c.kind != mutuallyExclusive || !c.contains(o) {
+			continue
+		}
+		for _, other := range c.options {
+			if other.source > source {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contains returns true if o is one of the options in the constraint.
+func (c *constraint) contains(o *option) bool {
+	for _, other := range c.options {
+		if other == o {
+			return true
+		}
+	}
+	return false
+}
+
+// joinNames joins the names of options for use in a sentence, like “--a, --b or --c”.
+func joinNames(options []*option, conjunction string) string {
+	names := []string{}
+	for _, o := range options {
+		names = append(names, o.name())
+	}
+	last := len(names) - 1
+	if last == 0 {
+		return names[0]
+	}
+	return fmt.Sprintf("%s %s %s", strings.Join(names[:last], ", "), conjunction, names[last])
+}
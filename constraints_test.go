@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestConstraints(t *testing.T) {
+	f := newFlags()
+	f.Flag("--json", new(bool), "")
+	f.Flag("--table", new(bool), "")
+	f.String("-u --user", new(string), "USER", "")
+	f.String("-p --password", new(string), "PASSWORD", "")
+	f.Int("--id", new(int), "ID", "")
+	f.String("--name", new(string), "NAME", "")
+	f.MutuallyExclusive("--json", "--table")
+	f.RequiredTogether("--user", "--password")
+	f.OneRequired("--id", "--name")
+
+	cases := []struct {
+		args      []string
+		wantError string
+	}{
+		{[]string{"--id", "1"}, ""},
+		{[]string{"--json", "--name", "x"}, ""},
+		{[]string{"--json", "--table", "--id", "1"}, "--json and --table can't be used together"},
+		{[]string{"-u", "me", "--id", "1"}, "--user requires --password"},
+		{[]string{"-u", "me", "-p", "secret", "--id", "1"}, ""},
+		{[]string{"--json"}, "missing --id or --name option"},
+	}
+	for _, c := range cases {
+		_, _, err := f.parse(c.args, false)
+		if err == nil {
+			err = f.check()
+		}
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.wantError {
+			t.Errorf("parsing %v returned error `%v`, want `%v`", c.args, got, c.wantError)
+		}
+	}
+
+	want := "(can't be used with --table)"
+	if got := f.definitions()[0].text; got != want {
+		t.Errorf("definition text == `%v`, want `%v`", got, want)
+	}
+	want = "(required unless --name is given)"
+	if got := f.definitions()[4].text; got != want {
+		t.Errorf("definition text == `%v`, want `%v`", got, want)
+	}
+}
+
+func TestConstraintsWithEnv(t *testing.T) {
+	var json, table bool
+	f := newFlags()
+	f.Flag("--json", &json, "")
+	f.Flag("--table", &table, "")
+	f.String("-u --user", new(string), "USER", "")
+	f.String("-p --password", new(string), "PASSWORD", "")
+	f.MutuallyExclusive("--json", "--table")
+	f.RequiredTogether("--user", "--password")
+	f.Env("--json", "TEST_JSON")
+	f.Env("--table", "TEST_TABLE")
+	f.Env("--user", "TEST_USER")
+	f.Env("--password", "TEST_PASSWORD")
+
+	cases := []struct {
+		args                []string
+		env                 map[string]string
+		wantError           string
+		wantJSON, wantTable bool
+	}{
+		{[]string{"--table"}, map[string]string{"TEST_JSON": "1"}, "", false, true},
+		{[]string{}, map[string]string{"TEST_JSON": "1"}, "", true, false},
+		{[]string{}, map[string]string{"TEST_JSON": "1", "TEST_TABLE": "1"},
+			"--json and --table can't be used together", true, true},
+		{[]string{"-u", "me"}, map[string]string{"TEST_PASSWORD": "secret"}, "", false, false},
+		{[]string{}, map[string]string{"TEST_USER": "me"}, "--user requires --password", false,
+			false},
+	}
+	for _, c := range cases {
+		json, table = false, false
+		for variable, value := range c.env {
+			os.Setenv(variable, value)
+		}
+		_, _, err := f.parse(c.args, false)
+		if err == nil {
+			err = f.applyEnv()
+		}
+		if err == nil {
+			err = f.check()
+		}
+		for variable := range c.env {
+			os.Unsetenv(variable)
+		}
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.wantError {
+			t.Errorf("parsing %v with %v returned error `%v`, want `%v`",
+				c.args, c.env, got, c.wantError)
+		}
+		if json != c.wantJSON || table != c.wantTable {
+			t.Errorf("parsing %v with %v set json, table = %v, %v, want %v, %v",
+				c.args, c.env, json, table, c.wantJSON, c.wantTable)
+		}
+	}
+}
+
+func TestJoinNames(t *testing.T) {
+	options := []*option{
+		{names: []string{"-a"}},
+		{names: []string{"-b", "--bee"}},
+		{names: []string{"--cee"}},
+	}
+	cases := []struct {
+		n    int
+		want string
+	}{
+		{1, "-a"},
+		{2, "-a or --bee"},
+		{3, "-a, --bee or --cee"},
+	}
+	for _, c := range cases {
+		got := joinNames(options[:c.n], "or")
+		if got != c.want {
+			t.Errorf("joinNames returned `%v`, want `%v`", got, c.want)
+		}
+	}
+}
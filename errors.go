@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ErrHelp is returned by Execute if the user asked for help. The help message has already been
+// printed when it’s returned.
+var ErrHelp = errors.New("help requested")
+
+// A UsageError is returned by Execute if the command-line arguments are invalid. Name is the name
+// of the command or group that found the error, for example “git remote add”.
+type UsageError struct {
+	Name string
+	Err  error
+	help string
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// A CommandError is returned by Execute if the command’s function returns an error. Name is the
+// name of the command, for example “git remote add”.
+type CommandError struct {
+	Name string
+	Err  error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// signalContext returns a context that’s cancelled when the program receives SIGINT or SIGTERM.
+// Once the context is done, it stops catching the signals, so a second one ends the program.
+func signalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+// exit handles an error returned by Execute the way Run does: it prints a message to w if needed
+// and exits with status 0 for ErrHelp, 2 for a UsageError, and 1 otherwise. It returns if err is
+// nil.
+func exit(w io.Writer, err error) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, ErrHelp) {
+		os.Exit(0)
+	}
+	fmt.Fprintln(w, err)
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(w, "Try '%s' for more information.\n", usageErr.help)
+		os.Exit(2)
+	}
+	os.Exit(1)
+}
@@ -2,7 +2,10 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,25 +19,97 @@ var helpFlags = map[string]bool{
 
 // Flags is used to define flags with and without arguments. It’s embedded in Cmd and Group; you
 // usually call its methods directly on those types.
+//
+// If AllowPrefixes is set, long flags can be abbreviated to any prefix that’s unique among the long
+// flags, for example “--verb” for “--verbose”.
 type Flags struct {
+	AllowPrefixes bool
+
 	// used for parsing
-	flags   map[string]*bool
-	options map[string]*option
+	flags       map[string]*option
+	options     map[string]*option
+	list        []*option
+	constraints []*constraint
 
-	// used for help message
-	defs []*definition
+	// flags of the parent group, if any
+	parent *Flags
 }
 
 func newFlags() Flags {
 	return Flags{
-		flags:   make(map[string]*bool),
+		flags:   make(map[string]*option),
 		options: make(map[string]*option),
-		defs:    []*definition{},
+		list:    []*option{},
 	}
 }
 
 type option struct {
-	set func(name, value string) error
+	names    []string
+	set      func(name, value string) error
+	required bool
+	env      string
+
+	// used for help message
+	terms        []string
+	usage        string
+	notes        []string
+	defaultValue string
+
+	// for options that can be repeated
+	reset func()
+	split bool
+
+	// for map options
+	keys   map[string]bool
+	unique bool
+
+	// for options defined with Choice
+	choices []string
+
+	// for options defined with OptionalString
+	optional bool
+	implicit string
+
+	// set for flags that sub-commands and sub-groups inherit, see Group.Persistent
+	persistent bool
+
+	// set for flags left out of the help message
+	hidden bool
+
+	// set while parsing: seen if the option has a value, source for where it came from
+	seen   bool
+	source int
+}
+
+// Sources for option values, in increasing order of precedence.
+const (
+	fromConfig = iota + 1
+	fromEnv
+	fromArgs
+)
+
+// apply sets the option’s value. For repeatable options, the first value replaces the default.
+func (o *option) apply(name, value string) error {
+	if !o.seen && o.reset != nil {
+		o.reset()
+	}
+	o.seen = true
+	if !o.split {
+		return o.set(name, value)
+	}
+	for _, v := range strings.Split(value, ",") {
+		err := o.set(name, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyArg sets the option’s value from the command-line.
+func (o *option) applyArg(name, value string) error {
+	o.source = fromArgs
+	return o.apply(name, value)
 }
 
 type entry struct {
@@ -48,15 +123,167 @@ type flagDefinition struct {
 	inline   string
 }
 
+// negated returns true if name is the “--no-” form of a flag defined with NegatableFlag.
+func (o *option) negated(name string) bool {
+	for _, n := range o.names {
+		if n == name {
+			return false
+		}
+	}
+	return strings.HasPrefix(name, "--no-")
+}
+
+// name returns the name used for the option in error messages: the last one given in the spec,
+// which is usually the long one.
+func (o *option) name() string {
+	return o.names[len(o.names)-1]
+}
+
 func (f *Flags) usage() string {
-	switch len(f.defs) {
+	line := []string{}
+	optional := 0
+	for _, o := range f.list {
+		if !o.required && !o.hidden {
+			optional++
+		}
+	}
+	switch optional {
 	case 0:
-		return ""
 	case 1:
-		return "[OPTION]"
+		line = append(line, "[OPTION]")
 	default:
-		return "[OPTION]..."
+		line = append(line, "[OPTION]...")
+	}
+	for _, o := range f.list {
+		if o.required && !o.hidden {
+			line = append(line, o.terms[len(o.terms)-1])
+		}
+	}
+	return strings.Join(line, " ")
+}
+
+// Required marks the flag with the given name as mandatory. Parsing the command-line fails if it’s
+// missing.
+func (f *Flags) Required(name string) {
+	f.lookup(name).required = true
+}
+
+// Hide leaves the flag with the given name out of the help message and makes Choices return nil for
+// it. It’s still accepted on the command-line, but only by its full name, not an abbreviation (see
+// AllowPrefixes); use it for experimental or debugging flags.
+func (f *Flags) Hide(name string) {
+	f.lookup(name).hidden = true
+}
+
+// HideDefault stops the help message from showing the default value of the flag with the given
+// name. By default, it shows the value the flag had when it was defined, unless it’s the zero
+// value.
+func (f *Flags) HideDefault(name string) {
+	f.lookup(name).defaultValue = ""
+}
+
+// formatDefault formats a default value for the help message. It returns "" for the zero value.
+func formatDefault(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// formatWithSuffix formats a number using the largest suffix that fits, for example “5k” for 5000,
+// or returns "" for zero.
+func formatWithSuffix(i int, suffixMap map[string]int) string {
+	if i == 0 {
+		return ""
+	}
+	suffix, factor := "", 1
+	for s, f := range suffixMap {
+		if f > factor && i%f == 0 {
+			suffix, factor = s, f
+		}
+	}
+	return fmt.Sprintf("%d%s", i/factor, suffix)
+}
+
+// Env sets an environment variable to use for the flag with the given name if it’s not given on the
+// command-line. The variable’s value is parsed like a command-line argument; for flags without a
+// value, it can be “true”, “false”, or a number for flags defined with Count.
+func (f *Flags) Env(name, variable string) {
+	o := f.lookup(name)
+	o.env = variable
+	o.notes = append(o.notes, "env: "+variable)
+}
+
+// applyEnv sets values from environment variables for flags that weren’t on the command-line. It
+// skips flags that are mutually exclusive with one that was.
+func (f *Flags) applyEnv() error {
+	for _, o := range f.list {
+		if o.env == "" || o.seen || f.excluded(o, fromEnv) {
+			continue
+		}
+		value := os.Getenv(o.env)
+		if value == "" {
+			continue
+		}
+		o.source = fromEnv
+		err := o.apply("$"+o.env, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup finds the flag or option with the given name. It panics if there’s none.
+func (f *Flags) lookup(name string) *option {
+	if o, ok := f.flags[name]; ok {
+		return o
+	}
+	if o, ok := f.options[name]; ok {
+		return o
+	}
+	panic(fmt.Sprintf("Flags: no flag %s", name))
+}
+
+// find returns the flag or the option with the given name; one of the results is nil. If it’s not
+// defined here, find looks at the flags of parent groups, starting with the closest one.
+func (f *Flags) find(name string) (flag, option *option) {
+	for p := f; p != nil; p = p.parent {
+		if o, ok := p.flags[name]; ok {
+			return o, nil
+		}
+		if o, ok := p.options[name]; ok {
+			return nil, o
+		}
+	}
+	return nil, nil
+}
+
+// checkInherited panics if a parent group has a persistent flag with the given name.
+func (f *Flags) checkInherited(name string) {
+	for p := f.parent; p != nil; p = p.parent {
+		fl, o := p.flags[name], p.options[name]
+		if (fl != nil && fl.persistent) || (o != nil && o.persistent) {
+			panic(fmt.Sprintf("Flags: %s is already defined as a persistent flag", name))
+		}
+	}
+}
+
+// check returns an error if a required flag is missing or a constraint is violated.
+func (f *Flags) check() error {
+	for _, o := range f.list {
+		if o.required && !o.seen {
+			return fmt.Errorf("missing %s option", o.name())
+		}
 	}
+	for _, c := range f.constraints {
+		err := c.check()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Flag defines a flag without a value.
@@ -65,72 +292,318 @@ func (f *Flags) Flag(spec string, p *bool, usage string) {
 	if err != nil {
 		panic(err.Error())
 	}
-	for _, name := range names {
-		f.flags[name] = p
-	}
-
-	f.defs = append(f.defs, &definition{
-		terms: names,
-		text:  usage,
+	o := f.addFlag(names, names, usage, func(name, value string) error {
+		b, err := parseBool(name, value)
+		if err != nil {
+			return err
+		}
+		*p = b
+		return nil
 	})
+	o.defaultValue = formatDefault(*p)
 }
 
-// String defines a flag with a string value.
-func (f *Flags) String(spec string, p *string, name, usage string) {
-	f.addOption(spec, name, usage, func(name, value string) error {
-		*p = value
+// NegatableFlag defines a flag without a value that can be turned off again. For each long name
+// like “--color” it also defines “--no-color”, which sets the value to false. If the flag is
+// given more than once, the last one wins.
+func (f *Flags) NegatableFlag(spec string, p *bool, usage string) {
+	names, err := splitSpec(spec)
+	if err != nil {
+		panic(err.Error())
+	}
+	negated := make(map[string]bool)
+	terms := []string{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, "--") {
+			terms = append(terms, name)
+			continue
+		}
+		no := "--no-" + name[2:]
+		negated[no] = true
+		terms = append(terms, "--[no-]"+name[2:])
+	}
+	o := f.addFlag(names, terms, usage, func(name, value string) error {
+		b, err := parseBool(name, value)
+		if err != nil {
+			return err
+		}
+		*p = b != negated[name]
 		return nil
 	})
+	for name := range negated {
+		f.checkInherited(name)
+		f.flags[name] = o
+	}
+	o.defaultValue = formatDefault(*p)
 }
 
-// Int defines a flag with an integer value.
-func (f *Flags) Int(spec string, p *int, name, usage string) {
-	f.addOption(spec, name, usage, func(name, value string) error {
+// Count defines a flag without a value that counts how often it’s given, for example to set a
+// verbosity level with “-vvv”. Each occurrence increments the value; the first one starts from the
+// value the flag had when it was defined.
+func (f *Flags) Count(spec string, p *int, usage string) {
+	names, err := splitSpec(spec)
+	if err != nil {
+		panic(err.Error())
+	}
+	initial := *p
+	o := f.addFlag(names, names, usage, func(name, value string) error {
+		if value == "" {
+			*p++
+			return nil
+		}
 		i, err := strconv.Atoi(value)
 		if err != nil {
-			return fmt.Errorf("invalid %s argument '%s'", name, value)
+			return invalidArgument(name, value)
 		}
 		*p = i
 		return nil
 	})
+	o.defaultValue = formatDefault(*p)
+	o.notes = append(o.notes, "may be repeated")
+	o.reset = func() { *p = initial }
+}
+
+func (f *Flags) addFlag(names, terms []string, usage string,
+	set func(name, value string) error) *option {
+	op := &option{
+		names: names,
+		set:   set,
+		terms: terms,
+		usage: usage,
+	}
+	for _, name := range names {
+		f.checkInherited(name)
+		f.flags[name] = op
+	}
+	f.list = append(f.list, op)
+	return op
+}
+
+// String defines a flag with a string value.
+func (f *Flags) String(spec string, p *string, name, usage string) {
+	Option(f, spec, p, name, usage, parseString)
+}
+
+// Int defines a flag with an integer value.
+func (f *Flags) Int(spec string, p *int, name, usage string) {
+	Option(f, spec, p, name, usage, strconv.Atoi)
 }
 
 // Float defines a flag with a float64 value. See strconv.ParseFloat for the format it recognizes.
 func (f *Flags) Float(spec string, p *float64, name, usage string) {
-	f.addOption(spec, name, usage, func(name, value string) error {
-		f, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return fmt.Errorf("invalid %s argument '%s'", name, value)
-		}
-		*p = f
-		return nil
-	})
+	Option(f, spec, p, name, usage, parseFloat)
 }
 
 // Duration defines a flag with a time.Duration value. See time.ParseDuration for the format it
 // recognizes.
 func (f *Flags) Duration(spec string, p *time.Duration, name, usage string) {
-	f.addOption(spec, name, usage, func(name, value string) error {
-		d, err := time.ParseDuration(value)
-		if err != nil {
-			return fmt.Errorf("invalid %s argument '%s'", name, value)
-		}
-		*p = d
-		return nil
-	})
+	Option(f, spec, p, name, usage, time.ParseDuration)
 }
 
 // Metric defines a flag with an integer value that allows the user to use metric suffixes, for
 // example “5k“ for 5000. Both lower-case and upper-case suffixes work.
 func (f *Flags) Metric(spec string, p *int, name, usage string) {
-	f.addOption(spec, name, usage, func(name, value string) error {
-		i, ok := parseWithSuffix(value, metricSuffixMap)
-		if !ok {
-			return fmt.Errorf("invalid %s argument '%s'", name, value)
+	o := f.addOption(spec, name, usage, setter(p, parseMetric))
+	o.defaultValue = formatWithSuffix(*p, metricSuffixMap)
+}
+
+// Bytes defines a flag with an integer value that allows the user to use binary suffixes, for
+// example “5k“ for 5*1024. Both lower-case and upper-case suffixes work.
+func (f *Flags) Bytes(spec string, p *int, name, usage string) {
+	o := f.addOption(spec, name, usage, setter(p, parseBytes))
+	o.defaultValue = formatWithSuffix(*p, bytesSuffixMap)
+}
+
+// Choice defines a flag with a string value that must be one of the given choices. The choices
+// are listed in the help message.
+func (f *Flags) Choice(spec string, p *string, name string, choices []string, usage string) {
+	list := strings.Join(choices, ", ")
+	o := f.addOption(spec, name, usage, func(name, value string) error {
+		for _, c := range choices {
+			if value == c {
+				*p = value
+				return nil
+			}
 		}
-		*p = i
+		return fmt.Errorf("invalid %s argument '%s' (choose from %s)", name, value, list)
+	})
+	o.defaultValue = *p
+	o.choices = append([]string{}, choices...)
+	o.notes = append(o.notes, "one of: "+list)
+}
+
+// Choices returns the values allowed for the flag with the given name if it was defined with
+// Choice, or nil otherwise. It’s meant to be used for shell completion.
+func (f *Flags) Choices(name string) []string {
+	o, ok := f.options[name]
+	if !ok || o.choices == nil || o.hidden {
+		return nil
+	}
+	return append([]string{}, o.choices...)
+}
+
+// OptionalString defines a flag with a string value that can be left out, like “--color[=WHEN]”.
+// The value has to be given in the same argument, as in “--color=always” or “-calways”; if it’s
+// left out, as in “--color”, the implicit value is used.
+func (f *Flags) OptionalString(spec string, p *string, name, implicit, usage string) {
+	o := f.addOption(spec, name, usage, func(name, value string) error {
+		*p = value
 		return nil
 	})
+	o.defaultValue = *p
+	o.optional = true
+	o.implicit = implicit
+	for i, n := range o.names {
+		if strings.HasPrefix(n, "--") {
+			o.terms[i] = fmt.Sprintf("%s[=%s]", n, name)
+		} else {
+			o.terms[i] = fmt.Sprintf("%s[%s]", n, name)
+		}
+	}
+}
+
+// StringSlice defines a flag with a string value that can be given more than once. Each value is
+// appended to the slice; the first one replaces whatever the slice contained before.
+func (f *Flags) StringSlice(spec string, p *[]string, name, usage string) {
+	Slice(f, spec, p, name, usage, parseString)
+}
+
+// IntSlice defines a flag with an integer value that can be given more than once. It works like
+// StringSlice.
+func (f *Flags) IntSlice(spec string, p *[]int, name, usage string) {
+	Slice(f, spec, p, name, usage, strconv.Atoi)
+}
+
+// FloatSlice defines a flag with a float64 value that can be given more than once. It works like
+// StringSlice.
+func (f *Flags) FloatSlice(spec string, p *[]float64, name, usage string) {
+	Slice(f, spec, p, name, usage, parseFloat)
+}
+
+// DurationSlice defines a flag with a time.Duration value that can be given more than once. It
+// works like StringSlice.
+func (f *Flags) DurationSlice(spec string, p *[]time.Duration, name, usage string) {
+	Slice(f, spec, p, name, usage, time.ParseDuration)
+}
+
+// StringMap defines a flag with a KEY=VALUE argument that can be given more than once, for example
+// “--label env=prod --label tier=web”. The first value replaces whatever the map contained before.
+// If a key is given more than once, the last value wins; call UniqueKeys to report an error
+// instead.
+func (f *Flags) StringMap(spec string, p *map[string]string, name, usage string) {
+	Map(f, spec, p, name, usage, parseString)
+}
+
+// IntMap defines a flag with a KEY=VALUE argument where the value is an integer. It works like
+// StringMap.
+func (f *Flags) IntMap(spec string, p *map[string]int, name, usage string) {
+	Map(f, spec, p, name, usage, strconv.Atoi)
+}
+
+// FloatMap defines a flag with a KEY=VALUE argument where the value is a float64. It works like
+// StringMap.
+func (f *Flags) FloatMap(spec string, p *map[string]float64, name, usage string) {
+	Map(f, spec, p, name, usage, parseFloat)
+}
+
+// DurationMap defines a flag with a KEY=VALUE argument where the value is a time.Duration. It works
+// like StringMap.
+func (f *Flags) DurationMap(spec string, p *map[string]time.Duration, name, usage string) {
+	Map(f, spec, p, name, usage, time.ParseDuration)
+}
+
+// UniqueKeys makes the flag with the given name, which must have been defined with one of the *Map
+// methods, report an error if the same key is given twice.
+func (f *Flags) UniqueKeys(name string) {
+	o, ok := f.options[name]
+	if !ok || o.keys == nil {
+		panic(fmt.Sprintf("Flags: no map option %s", name))
+	}
+	o.unique = true
+}
+
+// CommaSeparated makes the flag with the given name, which must have been defined with one of the
+// *Slice or *Map methods, split its value at commas, so “--include a,b” is the same as “--include a
+// --include b”.
+func (f *Flags) CommaSeparated(name string) {
+	o, ok := f.options[name]
+	if !ok || o.reset == nil {
+		panic(fmt.Sprintf("Flags: no repeatable option %s", name))
+	}
+	o.split = true
+}
+
+func (f *Flags) addSlice(spec, name, usage string, reset func(),
+	set func(name, value string) error) *option {
+	o := f.addOption(spec, name, usage, set)
+	o.reset = reset
+	o.notes = append(o.notes, "may be repeated")
+	return o
+}
+
+func (f *Flags) addMap(spec, name, usage string, reset func(),
+	set func(name, key, value string) error) *option {
+	var o *option
+	o = f.addOption(spec, name, usage, func(name, value string) error {
+		kv := strings.SplitN(value, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid %s argument '%s' (expected KEY=VALUE)", name, value)
+		}
+		key := kv[0]
+		if o.unique && o.keys[key] {
+			return fmt.Errorf("duplicate key '%s' for %s", key, name)
+		}
+		o.keys[key] = true
+		return set(name, key, kv[1])
+	})
+	o.keys = make(map[string]bool)
+	o.notes = append(o.notes, "may be repeated")
+	o.reset = func() {
+		o.keys = make(map[string]bool)
+		reset()
+	}
+	return o
+}
+
+func invalidArgument(name, value string) error {
+	return fmt.Errorf("invalid %s argument '%s'", name, value)
+}
+
+// parseBool parses the value for a flag without a value. It’s empty if the flag was given on the
+// command-line; other sources like environment variables give “true”, “false” etc.
+func parseBool(name, value string) (bool, error) {
+	if value == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, invalidArgument(name, value)
+	}
+	return b, nil
+}
+
+func parseString(s string) (string, error) {
+	return s, nil
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseMetric(s string) (int, error) {
+	i, ok := parseWithSuffix(s, metricSuffixMap)
+	if !ok {
+		return 0, strconv.ErrSyntax
+	}
+	return i, nil
+}
+
+func parseBytes(s string) (int, error) {
+	i, ok := parseWithSuffix(s, bytesSuffixMap)
+	if !ok {
+		return 0, strconv.ErrSyntax
+	}
+	return i, nil
 }
 
 var metricSuffixMap = map[string]int{
@@ -142,19 +615,6 @@ var metricSuffixMap = map[string]int{
 	"e": 1000000000000000000,
 }
 
-// Bytes defines a flag with an integer value that allows the user to use binary suffixes, for
-// example “5k“ for 5*1024. Both lower-case and upper-case suffixes work.
-func (f *Flags) Bytes(spec string, p *int, name, usage string) {
-	f.addOption(spec, name, usage, func(name, value string) error {
-		i, ok := parseWithSuffix(value, bytesSuffixMap)
-		if !ok {
-			return fmt.Errorf("invalid %s argument '%s'", name, value)
-		}
-		*p = i
-		return nil
-	})
-}
-
 var bytesSuffixMap = map[string]int{
 	"k": 1 << 10,
 	"m": 1 << 20,
@@ -186,17 +646,11 @@ func parseWithSuffix(s string, suffixMap map[string]int) (i int, ok bool) {
 	return i * factor, true
 }
 
-func (f *Flags) addOption(spec, name, usage string, set func(name, value string) error) {
+func (f *Flags) addOption(spec, name, usage string, set func(name, value string) error) *option {
 	names, err := splitSpec(spec)
 	if err != nil {
 		panic(err.Error())
 	}
-	op := &option{
-		set: set,
-	}
-	for _, name := range names {
-		f.options[name] = op
-	}
 
 	// add e.value where needed
 	terms := []string{}
@@ -204,10 +658,58 @@ func (f *Flags) addOption(spec, name, usage string, set func(name, value string)
 		terms = append(terms, fmt.Sprintf("%s %s", n, name))
 	}
 
-	f.defs = append(f.defs, &definition{
+	op := &option{
+		names: names,
+		set:   set,
 		terms: terms,
-		text:  usage,
-	})
+		usage: usage,
+	}
+	for _, name := range names {
+		f.checkInherited(name)
+		f.options[name] = op
+	}
+	f.list = append(f.list, op)
+	return op
+}
+
+// definitions returns the definitions used for the help message.
+func (f *Flags) definitions() []*definition {
+	defs := []*definition{}
+	for _, o := range f.list {
+		if !o.hidden {
+			defs = append(defs, o.definition())
+		}
+	}
+	return defs
+}
+
+// globalDefinitions returns the definitions for the persistent flags of parent groups, starting
+// with the closest one.
+func (f *Flags) globalDefinitions() []*definition {
+	defs := []*definition{}
+	for p := f.parent; p != nil; p = p.parent {
+		for _, o := range p.list {
+			if o.persistent && !o.hidden {
+				defs = append(defs, o.definition())
+			}
+		}
+	}
+	return defs
+}
+
+func (o *option) definition() *definition {
+	text := o.usage
+	notes := o.notes
+	if o.defaultValue != "" {
+		notes = append([]string{"default: " + o.defaultValue}, notes...)
+	}
+	if len(notes) > 0 {
+		text = strings.TrimSpace(fmt.Sprintf("%s (%s)", text, strings.Join(notes, "; ")))
+	}
+	return &definition{
+		terms: o.terms,
+		text:  text,
+	}
 }
 
 var splitRe = regexp.MustCompile(`^--?[^-]`)
@@ -228,25 +730,50 @@ func splitSpec(spec string) ([]string, error) {
 	return parts, nil
 }
 
-func (f *Flags) parse(args []string) (help bool, following []string, err error) {
+// parse parses flags at the beginning of args and returns the remaining arguments. If interleaved
+// is true, it also parses flags that follow positional arguments and returns only the positional
+// arguments. In both cases, “--” ends parsing of flags.
+func (f *Flags) parse(args []string, interleaved bool) (help bool, following []string, err error) {
+	f.reset()
 	for len(args) > 0 {
 		a := args[0]
+		if a == "--" {
+			return false, append(following, args[1:]...), nil
+		}
 		if !isFlag(a) {
-			break
+			if !interleaved {
+				break
+			}
+			following = append(following, a)
+			args = args[1:]
+			continue
 		}
 		args = args[1:]
 
+		if name, _ := splitFlag(a); !f.defined(name) && isShortFlags(a) {
+			help, args, err = f.parseShortFlags(a, args)
+			if err != nil || help {
+				return help, nil, err
+			}
+			continue
+		}
+
 		a, value := splitFlag(a)
+		if f.AllowPrefixes && !f.defined(a) {
+			a, err = f.expandPrefix(a)
+			if err != nil {
+				return false, nil, err
+			}
+		}
+		fl, o := f.find(a)
 		if value != "" {
-			_, ok := f.flags[a]
-			if ok {
+			if fl != nil {
 				return false, nil, fmt.Errorf("%s does not take a value", a)
 			}
-			o, ok := f.options[a]
-			if !ok {
+			if o == nil {
 				return false, nil, fmt.Errorf("unrecognized flag %s", a)
 			}
-			err := o.set(a, value)
+			err := o.applyArg(a, value)
 			if err != nil {
 				return false, nil, err
 			}
@@ -257,18 +784,26 @@ func (f *Flags) parse(args []string) (help bool, following []string, err error)
 			return true, nil, nil
 		}
 
-		ptr, ok := f.flags[a]
-		if ok {
-			*ptr = true
+		if fl != nil {
+			err := fl.applyArg(a, "")
+			if err != nil {
+				return false, nil, err
+			}
 			continue
 		}
 
-		o, ok := f.options[a]
-		if ok {
+		if o != nil && o.optional {
+			err := o.applyArg(a, o.implicit)
+			if err != nil {
+				return false, nil, err
+			}
+			continue
+		}
+		if o != nil {
 			if len(args) == 0 {
 				return false, nil, fmt.Errorf("missing value for argument %s", a)
 			}
-			err := o.set(a, args[0])
+			err := o.applyArg(a, args[0])
 			args = args[1:]
 			if err != nil {
 				return false, nil, err
@@ -279,11 +814,134 @@ func (f *Flags) parse(args []string) (help bool, following []string, err error)
 		return false, nil, fmt.Errorf("unrecognized flag %s", a)
 	}
 
+	return false, append(following, args...), nil
+}
+
+// expandPrefix returns the long flag that starts with the given prefix, for example “--verbose” for
+// “--verb”. It returns the prefix unchanged if there’s no such flag and an error if there’s more
+// than one.
+func (f *Flags) expandPrefix(prefix string) (string, error) {
+	if !strings.HasPrefix(prefix, "--") {
+		return prefix, nil
+	}
+	names := []string{}
+	for name := range helpFlags {
+		names = append(names, name)
+	}
+	for p := f; p != nil; p = p.parent {
+		for name := range p.flags {
+			names = append(names, name)
+		}
+		for name := range p.options {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// find matching names, counting different names for the same flag only once, but keeping
+	// “--x” and “--no-x” apart since they have opposite meanings
+	type meaning struct {
+		o       *option
+		negated bool
+	}
+	candidates := []string{}
+	found := make(map[meaning]bool)
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		o, option := f.find(name)
+		if o == nil {
+			o = option
+		}
+		if o != nil && o.hidden {
+			continue
+		}
+		m := meaning{o, o != nil && o.negated(name)}
+		if o != nil && found[m] {
+			continue
+		}
+		found[m] = true
+		candidates = append(candidates, name)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return prefix, nil
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous flag %s (could be %s)", prefix,
+			strings.Join(candidates, ", "))
+	}
+}
+
+// reset clears state left over from parsing an earlier command-line.
+func (f *Flags) reset() {
+	for _, o := range f.list {
+		o.seen = false
+		o.source = 0
+	}
+}
+
+// parseShortFlags parses a group of single-letter flags like “-pv”. An option in the group takes
+// the rest of the argument as its value, or the next argument if it’s the last letter.
+func (f *Flags) parseShortFlags(a string, args []string) (
+	help bool, following []string, err error) {
+	letters := []rune(a[1:])
+	for i, r := range letters {
+		name := "-" + string(r)
+		if helpFlags[name] {
+			return true, nil, nil
+		}
+
+		fl, o := f.find(name)
+		if fl != nil {
+			err := fl.applyArg(name, "")
+			if err != nil {
+				return false, nil, err
+			}
+			continue
+		}
+
+		if o != nil {
+			value := string(letters[i+1:])
+			if value == "" && o.optional {
+				value = o.implicit
+			} else if value == "" {
+				if len(args) == 0 {
+					return false, nil, fmt.Errorf("missing value for argument %s", name)
+				}
+				value, args = args[0], args[1:]
+			}
+			err := o.applyArg(name, value)
+			if err != nil {
+				return false, nil, err
+			}
+			return false, args, nil
+		}
+
+		return false, nil, fmt.Errorf("unrecognized flag %s in %s", name, a)
+	}
+
 	return false, args, nil
 }
 
+// defined returns true if name is a flag, an option, a flag of a parent group, or a help flag.
+func (f *Flags) defined(name string) bool {
+	if helpFlags[name] {
+		return true
+	}
+	fl, o := f.find(name)
+	return fl != nil || o != nil
+}
+
+func isShortFlags(s string) bool {
+	return len(s) > 2 && s[0] == '-' && s[1] != '-'
+}
+
 func isFlag(s string) bool {
-	if s == "" {
+	if len(s) < 2 {
 		return false
 	}
 	return s[0] == '-'
@@ -38,7 +38,7 @@ func TestParse(t *testing.T) {
 	f.String("-name", &name, "NAME", "")
 
 	args := "-m 2k -timeout 5m -v --percent 99.5 --count 7 -d 150G -name moon"
-	f.parse(strings.Split(args, " "))
+	f.parse(strings.Split(args, " "), false)
 	wantSize := 2048
 	wantTimeout := 5 * time.Minute
 	wantV := true
@@ -96,3 +96,463 @@ func TestSplitSpec(t *testing.T) {
 		}
 	}
 }
+
+func TestParseShortFlags(t *testing.T) {
+	var (
+		parents, verbose bool
+		mode             string
+	)
+	f := newFlags()
+	f.Flag("-p --parents", &parents, "")
+	f.Flag("-v --verbose", &verbose, "")
+	f.String("-m --mode", &mode, "MODE", "")
+	cases := []struct {
+		args                     []string
+		wantError                bool
+		wantParents, wantVerbose bool
+		wantMode                 string
+		wantFollowing            []string
+	}{
+		{
+			args:          []string{"-pv", "foo"},
+			wantParents:   true,
+			wantVerbose:   true,
+			wantFollowing: []string{"foo"},
+		},
+		{
+			args:          []string{"-m755", "foo"},
+			wantMode:      "755",
+			wantFollowing: []string{"foo"},
+		},
+		{
+			args:          []string{"-vpm", "755", "foo"},
+			wantParents:   true,
+			wantVerbose:   true,
+			wantMode:      "755",
+			wantFollowing: []string{"foo"},
+		},
+		{
+			args:        []string{"-pm700"},
+			wantParents: true,
+			wantMode:    "700",
+		},
+		{
+			args:      []string{"-vm"},
+			wantError: true,
+		},
+		{
+			args:      []string{"-pxv"},
+			wantError: true,
+		},
+	}
+	for _, c := range cases {
+		parents, verbose, mode = false, false, ""
+		_, following, err := f.parse(c.args, false)
+		if (err != nil) != c.wantError {
+			t.Errorf("parse(%v) returned error %v", c.args, err)
+			continue
+		}
+		if c.wantError {
+			continue
+		}
+		if parents != c.wantParents || verbose != c.wantVerbose || mode != c.wantMode {
+			t.Errorf("parse(%v) set parents, verbose, mode = %v, %v, %v, want %v, %v, %v",
+				c.args, parents, verbose, mode, c.wantParents, c.wantVerbose, c.wantMode)
+		}
+		if !reflect.DeepEqual(following, c.wantFollowing) {
+			t.Errorf("parse(%v) returned %v, want %v", c.args, following, c.wantFollowing)
+		}
+	}
+}
+
+func TestNegatableFlag(t *testing.T) {
+	var color bool
+	f := newFlags()
+	f.NegatableFlag("-c --color", &color, "colorize the output")
+	cases := []struct {
+		args    string
+		initial bool
+		want    bool
+	}{
+		{"--color", false, true},
+		{"--no-color", true, false},
+		{"-c --no-color", false, false},
+		{"--no-color --color", false, true},
+	}
+	for _, c := range cases {
+		color = c.initial
+		_, _, err := f.parse(strings.Split(c.args, " "), false)
+		if err != nil {
+			t.Errorf("parse(%v) returned error %v", c.args, err)
+			continue
+		}
+		if color != c.want {
+			t.Errorf("parse(%v) set color = %v, want %v", c.args, color, c.want)
+		}
+	}
+
+	wantTerms := []string{"-c", "--[no-]color"}
+	if got := f.definitions()[0].terms; !reflect.DeepEqual(got, wantTerms) {
+		t.Errorf("NegatableFlag added terms %v, want %v", got, wantTerms)
+	}
+}
+
+func TestCount(t *testing.T) {
+	var verbosity int
+	f := newFlags()
+	f.Count("-v --verbose", &verbosity, "increase verbosity")
+	cases := []struct {
+		args string
+		want int
+	}{
+		{"-v", 1},
+		{"-vvv", 3},
+		{"--verbose --verbose", 2},
+		{"-vv --verbose -v", 4},
+	}
+	for _, c := range cases {
+		verbosity = 0
+		_, _, err := f.parse(strings.Split(c.args, " "), false)
+		if err != nil {
+			t.Errorf("parse(%v) returned error %v", c.args, err)
+			continue
+		}
+		if verbosity != c.want {
+			t.Errorf("parse(%v) set verbosity = %v, want %v", c.args, verbosity, c.want)
+		}
+	}
+
+	wantText := "increase verbosity (may be repeated)"
+	if got := f.definitions()[0].text; got != wantText {
+		t.Errorf("Count added text `%v`, want `%v`", got, wantText)
+	}
+
+	verbosity = 1
+	command := New("command", func() {})
+	command.Count("-v", &verbosity, "")
+	executeCases := []struct {
+		arg  string
+		want int
+	}{
+		{"-vvv", 4},
+		{"-vv", 3},
+	}
+	for _, c := range executeCases {
+		err := command.Execute([]string{c.arg})
+		if err != nil || verbosity != c.want {
+			t.Errorf("Execute(%v) returned %v and set verbosity = %v, want nil, %v",
+				c.arg, err, verbosity, c.want)
+		}
+	}
+}
+
+func TestSlices(t *testing.T) {
+	var (
+		include, exclude []string
+		ports            []int
+		timeouts         []time.Duration
+	)
+	f := newFlags()
+	f.StringSlice("-i --include", &include, "PATTERN", "")
+	f.StringSlice("-x --exclude", &exclude, "PATTERN", "")
+	f.CommaSeparated("--exclude")
+	f.IntSlice("-p", &ports, "PORT", "")
+	f.DurationSlice("-t", &timeouts, "TIMEOUT", "")
+
+	include = []string{"default"}
+	args := "-i a --include b,c -x d,e -p 80 -p 443 -t 1s -t 1m"
+	_, _, err := f.parse(strings.Split(args, " "), false)
+	if err != nil {
+		t.Fatalf("parse(%v) returned error %v", args, err)
+	}
+	wantInclude := []string{"a", "b,c"}
+	wantExclude := []string{"d", "e"}
+	wantPorts := []int{80, 443}
+	wantTimeouts := []time.Duration{time.Second, time.Minute}
+	if !reflect.DeepEqual(include, wantInclude) {
+		t.Errorf("parse set include = %v, want %v", include, wantInclude)
+	}
+	if !reflect.DeepEqual(exclude, wantExclude) {
+		t.Errorf("parse set exclude = %v, want %v", exclude, wantExclude)
+	}
+	if !reflect.DeepEqual(ports, wantPorts) {
+		t.Errorf("parse set ports = %v, want %v", ports, wantPorts)
+	}
+	if !reflect.DeepEqual(timeouts, wantTimeouts) {
+		t.Errorf("parse set timeouts = %v, want %v", timeouts, wantTimeouts)
+	}
+
+	args = "-p 80 -p http"
+	_, _, err = f.parse(strings.Split(args, " "), false)
+	if err == nil {
+		t.Errorf("parse(%v) didn't return error", args)
+	}
+}
+
+func TestMaps(t *testing.T) {
+	var (
+		labels  map[string]string
+		weights map[string]int
+	)
+	f := newFlags()
+	f.StringMap("-l --label", &labels, "KEY=VALUE", "")
+	f.IntMap("-w", &weights, "KEY=N", "")
+	f.UniqueKeys("-w")
+	f.CommaSeparated("-w")
+
+	args := "-l env=prod --label tier=web -l env=dev -l empty= -w a=1,b=2"
+	_, _, err := f.parse(strings.Split(args, " "), false)
+	if err != nil {
+		t.Fatalf("parse(%v) returned error %v", args, err)
+	}
+	wantLabels := map[string]string{"env": "dev", "tier": "web", "empty": ""}
+	wantWeights := map[string]int{"a": 1, "b": 2}
+	if !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("parse set labels = %v, want %v", labels, wantLabels)
+	}
+	if !reflect.DeepEqual(weights, wantWeights) {
+		t.Errorf("parse set weights = %v, want %v", weights, wantWeights)
+	}
+
+	for _, args := range []string{"-l env", "-l =prod", "-w a=x", "-w a=1 -w a=2", "-w a=1,a=2"} {
+		_, _, err := f.parse(strings.Split(args, " "), false)
+		if err == nil {
+			t.Errorf("parse(%v) didn't return error", args)
+		}
+	}
+}
+
+func TestChoice(t *testing.T) {
+	var format string
+	f := newFlags()
+	f.Choice("-f --format", &format, "FORMAT", []string{"json", "yaml"}, "output format")
+
+	_, _, err := f.parse([]string{"--format", "yaml"}, false)
+	if err != nil {
+		t.Errorf("parse returned error %v", err)
+	}
+	if format != "yaml" {
+		t.Errorf("parse set format = %v, want %v", format, "yaml")
+	}
+
+	_, _, err = f.parse([]string{"-f", "xml"}, false)
+	wantError := "invalid -f argument 'xml' (choose from json, yaml)"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+
+	wantText := "output format (one of: json, yaml)"
+	if got := f.definitions()[0].text; got != wantText {
+		t.Errorf("Choice added text `%v`, want `%v`", got, wantText)
+	}
+
+	wantChoices := []string{"json", "yaml"}
+	if got := f.Choices("--format"); !reflect.DeepEqual(got, wantChoices) {
+		t.Errorf("Choices returned %v, want %v", got, wantChoices)
+	}
+	if got := f.Choices("--other"); got != nil {
+		t.Errorf("Choices returned %v for undefined flag, want nil", got)
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	var (
+		verbose, color, notify bool
+		count                  int
+	)
+	f := newFlags()
+	f.Flag("-v --verbose", &verbose, "")
+	f.NegatableFlag("--color --colour", &color, "")
+	f.Int("--count", &count, "N", "")
+	f.NegatableFlag("--notify", &notify, "")
+
+	_, _, err := f.parse([]string{"--verb"}, false)
+	if err == nil {
+		t.Errorf("parse accepted a prefix without AllowPrefixes")
+	}
+
+	f.AllowPrefixes = true
+	cases := []struct {
+		args                   string
+		wantError              string
+		wantVerbose, wantColor bool
+		wantCount              int
+	}{
+		{args: "--verb --col", wantVerbose: true, wantColor: true},
+		{args: "--colo --no-c", wantColor: false},
+		{args: "--cou=3", wantCount: 3},
+		{args: "--cou 4", wantCount: 4},
+		{args: "--co", wantError: "ambiguous flag --co (could be --color, --count)"},
+		{args: "--x", wantError: "unrecognized flag --x"},
+		{args: "--no",
+			wantError: "ambiguous flag --no (could be --no-color, --no-notify, --notify)"},
+	}
+	for _, c := range cases {
+		verbose, color, count = false, false, 0
+		_, _, err := f.parse(strings.Split(c.args, " "), false)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.wantError {
+			t.Errorf("parse(%v) returned error `%v`, want `%v`", c.args, got, c.wantError)
+			continue
+		}
+		if verbose != c.wantVerbose || color != c.wantColor || count != c.wantCount {
+			t.Errorf("parse(%v) set verbose, color, count = %v, %v, %v, want %v, %v, %v",
+				c.args, verbose, color, count, c.wantVerbose, c.wantColor, c.wantCount)
+		}
+	}
+
+	notifyCases := []struct {
+		arg  string
+		want bool
+	}{
+		{"--no-n", false},
+		{"--not", true},
+	}
+	for _, c := range notifyCases {
+		notify = !c.want
+		_, _, err := f.parse([]string{c.arg}, false)
+		if err != nil || notify != c.want {
+			t.Errorf("parse(%v) returned %v and set notify = %v, want nil, %v",
+				c.arg, err, notify, c.want)
+		}
+	}
+}
+
+func TestOptionalString(t *testing.T) {
+	var color string
+	var verbose bool
+	f := newFlags()
+	f.OptionalString("-c --color", &color, "WHEN", "auto", "colorize the output")
+	f.Flag("-v", &verbose, "")
+	cases := []struct {
+		args          string
+		wantColor     string
+		wantFollowing []string
+	}{
+		{"--color", "auto", nil},
+		{"--color=always", "always", nil},
+		{"--color never", "auto", []string{"never"}},
+		{"-c", "auto", nil},
+		{"-cnever", "never", nil},
+		{"-vc foo", "auto", []string{"foo"}},
+	}
+	for _, c := range cases {
+		color = ""
+		_, following, err := f.parse(strings.Split(c.args, " "), false)
+		if err != nil {
+			t.Errorf("parse(%v) returned error %v", c.args, err)
+			continue
+		}
+		if color != c.wantColor || !reflect.DeepEqual(following, c.wantFollowing) {
+			t.Errorf("parse(%v) set color = %v and returned %v, want %v, %v",
+				c.args, color, following, c.wantColor, c.wantFollowing)
+		}
+	}
+
+	wantTerms := []string{"-c[WHEN]", "--color[=WHEN]"}
+	if got := f.definitions()[0].terms; !reflect.DeepEqual(got, wantTerms) {
+		t.Errorf("OptionalString added terms %v, want %v", got, wantTerms)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	var (
+		port    = 8080
+		host    string
+		size    = 2 << 20
+		rate    = 1500
+		timeout = 30 * time.Second
+		color   = true
+		tags    = []string{"a", "b"}
+		secret  = "hunter2"
+	)
+	f := newFlags()
+	f.Int("-p --port", &port, "PORT", "port to listen on")
+	f.String("--host", &host, "HOST", "host to listen on")
+	f.Bytes("--max-size", &size, "SIZE", "")
+	f.Metric("--rate", &rate, "RATE", "")
+	f.Duration("--timeout", &timeout, "D", "")
+	f.NegatableFlag("--color", &color, "")
+	f.StringSlice("--tag", &tags, "TAG", "")
+	f.String("--secret", &secret, "SECRET", "")
+	f.HideDefault("--secret")
+	f.Env("--port", "PORT")
+
+	want := []string{
+		"port to listen on (default: 8080; env: PORT)",
+		"host to listen on",
+		"(default: 2m)",
+		"(default: 1500)",
+		"(default: 30s)",
+		"(default: true)",
+		"(default: a,b; may be repeated)",
+		"",
+	}
+	for i, def := range f.definitions() {
+		if def.text != want[i] {
+			t.Errorf("definition %v has text `%v`, want `%v`", i, def.text, want[i])
+		}
+	}
+}
+
+func TestHide(t *testing.T) {
+	var debug bool
+	var mode string
+	f := newFlags()
+	f.Flag("-v --verbose", new(bool), "")
+	f.Flag("--debug", &debug, "")
+	f.Choice("--mode", &mode, "MODE", []string{"fast", "safe"}, "")
+	f.Hide("--debug")
+	f.Hide("--mode")
+
+	if got, want := f.usage(), "[OPTION]"; got != want {
+		t.Errorf("usage returned %v, want %v", got, want)
+	}
+	defs := f.definitions()
+	if len(defs) != 1 || defs[0].terms[1] != "--verbose" {
+		t.Errorf("definitions returned %v definitions, want only --verbose", len(defs))
+	}
+	if got := f.Choices("--mode"); got != nil {
+		t.Errorf("Choices returned %v for hidden flag, want nil", got)
+	}
+
+	_, _, err := f.parse([]string{"--debug", "--mode", "safe"}, false)
+	if err != nil || !debug || mode != "safe" {
+		t.Errorf("parse returned %v, set debug = %v, mode = %v, want nil, true, safe",
+			err, debug, mode)
+	}
+
+	f.Flag("--debug-internal", new(bool), "")
+	f.Hide("--debug-internal")
+	f.AllowPrefixes = true
+	_, _, err = f.parse([]string{"--deb"}, false)
+	wantError := "unrecognized flag --deb"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+}
+
+func TestFormatWithSuffix(t *testing.T) {
+	cases := []struct {
+		i         int
+		suffixMap map[string]int
+		want      string
+	}{
+		{0, metricSuffixMap, ""},
+		{5000, metricSuffixMap, "5k"},
+		{1500, metricSuffixMap, "1500"},
+		{3000000, metricSuffixMap, "3m"},
+		{2048, bytesSuffixMap, "2k"},
+		{1 << 30, bytesSuffixMap, "1g"},
+		{-4096, bytesSuffixMap, "-4k"},
+	}
+	for _, c := range cases {
+		got := formatWithSuffix(c.i, c.suffixMap)
+		if got != c.want {
+			t.Errorf("formatWithSuffix(%v) == %v, want %v", c.i, got, c.want)
+		}
+	}
+}
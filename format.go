@@ -6,9 +6,8 @@ import (
 	"strings"
 )
 
-// formatHelp formats the help text for Cmd or Group.
-func formatHelp(usage, summary, details string, defs []*definitionList) string {
-	columns := terminalColumns()
+// formatHelp formats the help text for Cmd or Group to fit the given number of columns.
+func formatHelp(columns int, usage, summary, details string, defs []*definitionList) string {
 	sections := []string{}
 	sections = append(sections, wrapParagraphs(usage, columns))
 	if summary != "" {
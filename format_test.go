@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"os"
 	"reflect"
 	"testing"
 )
@@ -198,8 +197,7 @@ non-recent files and FORMAT2 to recent files. TIME_STYLE prefixed with 'posix-'
 effect only outside the POSIX locale. Also the TIME_STYLE environment variable sets the
 default style to use.
 `
-	os.Setenv("COLUMNS", "90")
-	got := formatHelp(usage, summary, details, defs)
+	got := formatHelp(90, usage, summary, details, defs)
 	if got != want {
 		t.Errorf("formatHelp returned `%v`, want `%v`", got, want)
 	}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Option defines a flag with a value of any type. The parse function converts the value from the
+// command-line; if it returns an error, parsing fails with a message like “invalid --count
+// argument 'x'”.
+func Option[T any](f *Flags, spec string, p *T, name, usage string, parse func(string) (T, error)) {
+	o := f.addOption(spec, name, usage, setter(p, parse))
+	o.defaultValue = formatDefault(*p)
+}
+
+// Slice defines a flag with a value of any type that can be given more than once. It works like
+// Flags.StringSlice.
+func Slice[T any](f *Flags, spec string, p *[]T, name, usage string,
+	parse func(string) (T, error)) {
+	o := f.addSlice(spec, name, usage, func() { *p = nil }, func(name, value string) error {
+		v, err := parse(value)
+		if err != nil {
+			return invalidArgument(name, value)
+		}
+		*p = append(*p, v)
+		return nil
+	})
+	values := []string{}
+	for _, v := range *p {
+		values = append(values, fmt.Sprint(v))
+	}
+	o.defaultValue = strings.Join(values, ",")
+}
+
+// Map defines a flag with a KEY=VALUE argument where the value can be of any type. It works like
+// Flags.StringMap.
+func Map[T any](f *Flags, spec string, p *map[string]T, name, usage string,
+	parse func(string) (T, error)) {
+	reset := func() { *p = make(map[string]T) }
+	o := f.addMap(spec, name, usage, reset, func(name, key, value string) error {
+		v, err := parse(value)
+		if err != nil {
+			return invalidArgument(name, value)
+		}
+		(*p)[key] = v
+		return nil
+	})
+	pairs := []string{}
+	for k, v := range *p {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(pairs)
+	o.defaultValue = strings.Join(pairs, ",")
+}
+
+// Arg defines a positional argument of any type. If parse returns an error, parsing fails with a
+// message like “invalid COUNT argument 'x'”.
+func Arg[T any](c *Cmd, name string, p *T, parse func(string) (T, error)) {
+	c.addArg(name, false, setter(p, parse))
+}
+
+// OptionalArg defines an optional positional argument of any type.
+func OptionalArg[T any](c *Cmd, name string, p *T, parse func(string) (T, error)) {
+	c.addArg(name, true, setter(p, parse))
+}
+
+// RepeatedArg defines an argument of any type that can be present one or more times.
+func RepeatedArg[T any](c *Cmd, name string, p *[]T, parse func(string) (T, error)) {
+	c.addArgs(name, false, sliceSetter(p, parse))
+}
+
+// OptionalRepeatedArg defines an argument of any type that can be present zero or more times.
+func OptionalRepeatedArg[T any](c *Cmd, name string, p *[]T, parse func(string) (T, error)) {
+	c.addArgs(name, true, sliceSetter(p, parse))
+}
+
+// setter returns a function that converts a value with parse and stores it in p.
+func setter[T any](p *T, parse func(string) (T, error)) func(name, value string) error {
+	return func(name, value string) error {
+		v, err := parse(value)
+		if err != nil {
+			return invalidArgument(name, value)
+		}
+		*p = v
+		return nil
+	}
+}
+
+// sliceSetter returns a function that converts values with parse and stores them in p.
+func sliceSetter[T any](p *[]T, parse func(string) (T, error)) func(string, []string) error {
+	return func(name string, values []string) error {
+		result := make([]T, len(values))
+		for i, value := range values {
+			v, err := parse(value)
+			if err != nil {
+				return invalidArgument(name, value)
+			}
+			result[i] = v
+		}
+		*p = result
+		return nil
+	}
+}
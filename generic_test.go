@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestGenericOptions(t *testing.T) {
+	var (
+		endpoint *url.URL
+		mirrors  []*url.URL
+		limits   map[string]uint64
+	)
+	parseUint := func(s string) (uint64, error) {
+		return strconv.ParseUint(s, 10, 64)
+	}
+	f := newFlags()
+	Option(&f, "--endpoint", &endpoint, "URL", "", url.Parse)
+	Slice(&f, "--mirror", &mirrors, "URL", "", url.Parse)
+	Map(&f, "--limit", &limits, "KEY=N", "", parseUint)
+
+	args := []string{
+		"--endpoint", "https://example.com/api",
+		"--mirror", "https://a.example.com", "--mirror", "https://b.example.com",
+		"--limit", "cpu=2",
+	}
+	_, _, err := f.parse(args, false)
+	if err != nil {
+		t.Fatalf("parse returned error %v", err)
+	}
+	if endpoint.Host != "example.com" {
+		t.Errorf("parse set endpoint = %v", endpoint)
+	}
+	if len(mirrors) != 2 || mirrors[1].Host != "b.example.com" {
+		t.Errorf("parse set mirrors = %v", mirrors)
+	}
+	if want := map[string]uint64{"cpu": 2}; !reflect.DeepEqual(limits, want) {
+		t.Errorf("parse set limits = %v, want %v", limits, want)
+	}
+
+	_, _, err = f.parse([]string{"--limit", "cpu=-1"}, false)
+	wantError := "invalid --limit argument '-1'"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+}
+
+func TestGenericArgs(t *testing.T) {
+	var (
+		force bool
+		ids   []int
+	)
+	command := New("command", func() {})
+	Arg(command, "FORCE", &force, strconv.ParseBool)
+	RepeatedArg(command, "ID", &ids, strconv.Atoi)
+
+	_, err := command.parse([]string{"true", "1", "2", "3"})
+	if err != nil {
+		t.Fatalf("parse returned error %v", err)
+	}
+	if !force || !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Errorf("parse set force, ids = %v, %v, want %v, %v", force, ids, true, []int{1, 2, 3})
+	}
+
+	_, err = command.parse([]string{"true", "1", "two"})
+	wantError := "invalid ID argument 'two'"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+}
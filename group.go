@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -10,12 +13,30 @@ import (
 //
 // The Summary and Details fields are printed at the beginning and end, respectively, of the help
 // message. They won’t be printed if left empty.
+//
+// Hidden works like for Cmd: a hidden sub-group isn’t listed in its parent’s help message.
+//
+// Stdout, Stderr and Columns work like for Cmd. Sub-commands and sub-groups inherit them unless
+// they set their own.
+//
+// The group’s flags can be given before the name of the sub-command or sub-group, or anywhere
+// after it, as in “git status -C /repo”. If a sub-command defines a flag with the same name, its
+// own flag wins after its name; use Persistent to rule out such conflicts.
 type Group struct {
 	Flags
 	Summary, Details string
+	Hidden           bool
+	Stdout, Stderr   io.Writer
+	Columns          int
 	name             string
+	parent           *Group
 	groups           map[string]*Group
 	commands         map[string]*Cmd
+	groupNames       []string
+	commandNames     []string
+	aliases          map[string][]string
+	configPath       string
+	config           *config
 }
 
 // NewGroup returns a new group of commands with the specified name.
@@ -25,33 +46,136 @@ func NewGroup(name string) *Group {
 		name:     name,
 		groups:   make(map[string]*Group),
 		commands: make(map[string]*Cmd),
+		aliases:  make(map[string][]string),
 	}
 }
 
 // Command adds a command.
 func (g *Group) Command(name string, f func()) *Cmd {
 	command := New(fmt.Sprintf("%s %s", g.name, name), f)
-	g.commands[name] = command
+	g.addCommand(name, command)
+	return command
+}
+
+// CommandContext adds a command with a function that gets a context and can return an error. See
+// NewContext.
+func (g *Group) CommandContext(name string, f func(ctx context.Context) error) *Cmd {
+	command := NewContext(fmt.Sprintf("%s %s", g.name, name), f)
+	g.addCommand(name, command)
 	return command
 }
 
+func (g *Group) addCommand(name string, command *Cmd) {
+	g.checkAlias(name)
+	command.parent = g
+	command.Flags.parent = &g.Flags
+	g.commands[name] = command
+	g.commandNames = append(g.commandNames, name)
+}
+
 // Group adds a sub-group.
 func (g *Group) Group(name string) *Group {
+	g.checkAlias(name)
 	group := NewGroup(fmt.Sprintf("%s %s", g.name, name))
+	group.parent = g
+	group.Flags.parent = &g.Flags
 	g.groups[name] = group
+	g.groupNames = append(g.groupNames, name)
 	return group
 }
 
-func (g *Group) errorAndExit(msg string) {
-	w := os.Stderr
-	fmt.Fprintf(w, "%s: %s\n", g.name, msg)
-	fmt.Fprintf(w, "Try '%s help' for more information.\n", g.name)
-	os.Exit(2)
+// Alias defines alternative names for the sub-command or sub-group with the given name, for example
+// “rm” for “remove”. The help message lists them next to the name. It panics if there’s no such
+// sub-command or sub-group, or if an alias is “help” or already in use. Adding a sub-command or
+// sub-group whose name is an alias panics as well.
+func (g *Group) Alias(name string, aliases ...string) {
+	if g.groups[name] == nil && g.commands[name] == nil {
+		panic(fmt.Sprintf("Group: no command or group %s", name))
+	}
+	for _, alias := range aliases {
+		if alias == "help" || g.groups[alias] != nil || g.commands[alias] != nil {
+			panic(fmt.Sprintf("Group: %s is already in use", alias))
+		}
+		g.checkAlias(alias)
+		g.aliases[name] = append(g.aliases[name], alias)
+	}
+}
+
+// checkAlias panics if name is an alias.
+func (g *Group) checkAlias(name string) {
+	if g.resolve(name) != name {
+		panic(fmt.Sprintf("Group: %s is already in use as an alias", name))
+	}
+}
+
+// resolve returns the name of the sub-command or sub-group with the given alias, or the argument
+// unchanged if it’s not an alias.
+func (g *Group) resolve(alias string) string {
+	for name, aliases := range g.aliases {
+		for _, a := range aliases {
+			if a == alias {
+				return name
+			}
+		}
+	}
+	return alias
+}
+
+// Persistent makes the flag with the given name persistent: the help messages of all sub-commands
+// and sub-groups list it under “Global options”. It panics if a sub-command or sub-group already
+// has a flag with the same name; defining one later panics as well.
+func (g *Group) Persistent(name string) {
+	o := g.lookup(name)
+	for n, fl := range g.flags {
+		if fl == o {
+			g.checkDescendants(n)
+		}
+	}
+	for n, op := range g.options {
+		if op == o {
+			g.checkDescendants(n)
+		}
+	}
+	o.persistent = true
+}
+
+// checkDescendants panics if a sub-command or sub-group has a flag with the given name.
+func (g *Group) checkDescendants(name string) {
+	fail := func() {
+		panic(fmt.Sprintf("Group: %s is already defined by a sub-command or sub-group", name))
+	}
+	for _, c := range g.commands {
+		if c.flags[name] != nil || c.options[name] != nil {
+			fail()
+		}
+	}
+	for _, sub := range g.groups {
+		if sub.flags[name] != nil || sub.options[name] != nil {
+			fail()
+		}
+		sub.checkDescendants(name)
+	}
+}
+
+// ConfigFile sets a configuration file to read option values from. It works like Cmd.ConfigFile;
+// values for sub-commands and sub-groups are in a section with their name. In INI files, that’s a
+// line like “[status]” or, for nested groups, “[remote.add]”; in JSON files it’s a nested object.
+// Like an unknown key, a section that isn’t for a sub-command or sub-group is an error.
+func (g *Group) ConfigFile(path string) {
+	g.configPath = path
+}
+
+func (g *Group) usageError(err error) error {
+	return &UsageError{
+		Name: g.name,
+		Err:  err,
+		help: g.name + " help",
+	}
 }
 
-func (g *Group) helpAndExit() {
-	fmt.Fprintf(os.Stdout, g.Help())
-	os.Exit(0)
+func (g *Group) printHelp() error {
+	fmt.Fprint(g.stdout(), g.Help())
+	return ErrHelp
 }
 
 // Help returns a help message.
@@ -59,7 +183,11 @@ func (g *Group) Help() string {
 	defs := []*definitionList{
 		{
 			title:       "Options",
-			definitions: g.Flags.defs,
+			definitions: g.Flags.definitions(),
+		},
+		{
+			title:       "Global options",
+			definitions: g.Flags.globalDefinitions(),
 		},
 		{
 			title:       "Groups",
@@ -70,7 +198,37 @@ func (g *Group) Help() string {
 			definitions: g.commandDefinitions(),
 		},
 	}
-	return formatHelp(g.usage(), g.Summary, g.Details, defs)
+	return formatHelp(g.columns(), g.usage(), g.Summary, g.Details, defs)
+}
+
+func (g *Group) stdout() io.Writer {
+	if g.Stdout != nil {
+		return g.Stdout
+	}
+	if g.parent != nil {
+		return g.parent.stdout()
+	}
+	return os.Stdout
+}
+
+func (g *Group) stderr() io.Writer {
+	if g.Stderr != nil {
+		return g.Stderr
+	}
+	if g.parent != nil {
+		return g.parent.stderr()
+	}
+	return os.Stderr
+}
+
+func (g *Group) columns() int {
+	if g.Columns != 0 {
+		return g.Columns
+	}
+	if g.parent != nil {
+		return g.parent.columns()
+	}
+	return terminalColumns()
 }
 
 func (g *Group) summary() string {
@@ -83,10 +241,13 @@ func (g *Group) details() string {
 
 func (g *Group) groupDefinitions() []*definition {
 	defs := []*definition{}
-	for name, g := range g.groups {
+	for _, name := range g.groupNames {
+		if g.groups[name].Hidden {
+			continue
+		}
 		defs = append(defs, &definition{
-			terms: []string{name},
-			text:  g.Summary,
+			terms: append([]string{name}, g.aliases[name]...),
+			text:  g.groups[name].Summary,
 		})
 	}
 	return defs
@@ -94,10 +255,13 @@ func (g *Group) groupDefinitions() []*definition {
 
 func (g *Group) commandDefinitions() []*definition {
 	defs := []*definition{}
-	for name, c := range g.commands {
+	for _, name := range g.commandNames {
+		if g.commands[name].Hidden {
+			continue
+		}
 		defs = append(defs, &definition{
-			terms: []string{name},
-			text:  c.Summary,
+			terms: append([]string{name}, g.aliases[name]...),
+			text:  g.commands[name].Summary,
 		})
 	}
 	return defs
@@ -109,55 +273,113 @@ func (g *Group) usage() string {
 		line = append(line, s)
 	}
 	groupOrCommand := []string{}
-	if len(g.groups) > 0 {
+	if len(g.groupDefinitions()) > 0 {
 		groupOrCommand = append(groupOrCommand, "GROUP")
 	}
-	if len(g.commands) > 0 {
+	if len(g.commandDefinitions()) > 0 {
 		groupOrCommand = append(groupOrCommand, "COMMAND")
 	}
-	line = append(line, strings.Join(groupOrCommand, " | "))
+	if len(groupOrCommand) > 0 {
+		line = append(line, strings.Join(groupOrCommand, " | "))
+	}
 	return strings.Join(line, " ")
 }
 
 // Run parses the given command-line arguments, sets values for given flags and calls the function
 // for the selected command. It’s usually called with os.Args[1:].
+//
+// If the user asks for help, Run prints the help message and exits. If the command-line is invalid,
+// it prints an error message and exits with status 2. See NewContext for commands that return an
+// error.
 func (g *Group) Run(args []string) {
-	g.run(args, false)
+	exit(g.stderr(), g.execute(context.Background(), args, false, true))
 }
 
-func (g *Group) run(args []string, helpMode bool) {
+// Execute is like Run, but it returns an error instead of exiting the program. If the user asks for
+// help, it prints the help message and returns ErrHelp. If the command-line is invalid, it returns
+// a *UsageError. If the command’s function returns an error, it returns a *CommandError.
+func (g *Group) Execute(args []string) error {
+	return g.ExecuteContext(context.Background(), args)
+}
+
+// ExecuteContext is like Execute, but passes the given context to a command added with
+// CommandContext.
+func (g *Group) ExecuteContext(ctx context.Context, args []string) error {
+	return g.execute(ctx, args, false, false)
+}
+
+// execute parses the group’s flags and runs the selected command or sub-group. The signals
+// argument is passed on to Cmd.execute.
+func (g *Group) execute(ctx context.Context, args []string, helpMode, signals bool) error {
 	// call Flags.parse
-	help, args, err := g.Flags.parse(args)
+	help, args, err := g.Flags.parse(args, false)
 	if err != nil {
-		g.errorAndExit(err.Error())
+		return g.usageError(err)
 	}
 	if help {
-		g.helpAndExit()
+		return g.printHelp()
+	}
+	if !helpMode && g.configPath != "" {
+		g.config, err = readConfig(g.configPath)
+		if err != nil {
+			return g.usageError(err)
+		}
 	}
 
 	// select group or command
 	if len(args) == 0 {
 		if helpMode {
-			g.helpAndExit()
+			return g.printHelp()
 		}
-		g.errorAndExit("command expected")
+		return g.usageError(errors.New("command expected"))
 	}
 	a, args := args[0], args[1:]
 	if a == "help" {
-		g.run(args, true)
-		return
+		return g.execute(ctx, args, true, signals)
 	}
-	if group, ok := g.groups[a]; ok {
-		group.run(args, helpMode)
-		return
+	name := g.resolve(a)
+	if group, ok := g.groups[name]; ok {
+		group.config = g.config.section(name)
+		return group.execute(ctx, args, helpMode, signals)
 	}
-	if command, ok := g.commands[a]; ok {
+	if command, ok := g.commands[name]; ok {
+		command.config = g.config.section(name)
 		if helpMode {
-			command.helpAndExit()
-		} else {
-			command.Run(args)
+			return command.printHelp()
+		}
+		return command.execute(ctx, args, signals)
+	}
+	return g.usageError(fmt.Errorf("'%s' is not a %s command", a, g.name))
+}
+
+// finish sets values from environment variables and the configuration file and checks the flags of
+// the group and its parents. It’s called once the selected command has parsed its flags, since
+// those may include persistent flags.
+func (g *Group) finish() error {
+	if g.parent != nil {
+		err := g.parent.finish()
+		if err != nil {
+			return err
 		}
-		return
 	}
-	g.errorAndExit(fmt.Sprintf("'%s' is not a %s command", a, g.name))
+	err := g.Flags.applyEnv()
+	if err != nil {
+		return err
+	}
+	err = g.Flags.applyConfig(g.config)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for name := range g.groups {
+		names[name] = true
+	}
+	for name := range g.commands {
+		names[name] = true
+	}
+	err = g.config.checkSections(&g.Flags, names)
+	if err != nil {
+		return err
+	}
+	return g.Flags.check()
 }
@@ -1,6 +1,10 @@
 package cmd
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
 
 func TestGroupUsage(t *testing.T) {
 	g := NewGroup("service")
@@ -52,13 +56,263 @@ func TestGroupRun(t *testing.T) {
 	database.String("--host", new(string), "HOST", "")
 	database.Int("--port", new(int), "PORT", "")
 
-	g.run([]string{"start"}, false)
+	g.Execute([]string{"start"})
 	if !startCalled {
 		t.Errorf("Group.run didn't call expected function")
 	}
 
-	g.run([]string{"check", "database"}, false)
+	g.Execute([]string{"check", "database"})
 	if !databaseCalled {
 		t.Errorf("Group.run didn't call expected function")
 	}
 }
+
+func TestGroupExecute(t *testing.T) {
+	var called bool
+	g := NewGroup("service")
+	check := g.Group("check")
+	database := check.Command("database", func() { called = true })
+	database.Int("--port", new(int), "PORT", "")
+
+	err := g.Execute([]string{"check", "database", "--port", "5432"})
+	if err != nil || !called {
+		t.Errorf("Execute returned %v and called = %v, want nil, true", err, called)
+	}
+
+	cases := []struct {
+		args     []string
+		wantName string
+		wantErr  string
+	}{
+		{[]string{}, "service", "command expected"},
+		{[]string{"stop"}, "service", "'stop' is not a service command"},
+		{[]string{"check", "database", "--port", "x"}, "service check database",
+			"invalid --port argument 'x'"},
+	}
+	for _, c := range cases {
+		err := g.Execute(c.args)
+		var usageErr *UsageError
+		if !errors.As(err, &usageErr) {
+			t.Errorf("Execute(%v) returned %v, want a *UsageError", c.args, err)
+			continue
+		}
+		if usageErr.Name != c.wantName || usageErr.Err.Error() != c.wantErr {
+			t.Errorf("Execute(%v) returned error for %v: %v, want %v: %v",
+				c.args, usageErr.Name, usageErr.Err, c.wantName, c.wantErr)
+		}
+	}
+}
+
+func TestGroupOutput(t *testing.T) {
+	b := new(strings.Builder)
+	g := NewGroup("service")
+	g.Stdout = b
+	g.Columns = 40
+	check := g.Group("check")
+	database := check.Command("database", func() {})
+	database.Summary = "Check that the database is reachable and responds to queries."
+
+	err := g.Execute([]string{"help", "check", "database"})
+	if err != ErrHelp {
+		t.Errorf("Execute returned %v, want ErrHelp", err)
+	}
+	want := `Usage: service check database
+
+Check that the database is reachable and
+responds to queries.
+`
+	if got := b.String(); got != want {
+		t.Errorf("Execute printed `%s`, want `%s`", got, want)
+	}
+}
+
+func TestGroupPersistent(t *testing.T) {
+	var dir, host string
+	var verbose bool
+	g := NewGroup("service")
+	g.String("-C", &dir, "PATH", "run as if started in PATH")
+	g.Persistent("-C")
+	check := g.Group("check")
+	check.Flag("-v --verbose", &verbose, "print details")
+	check.Persistent("-v")
+	database := check.Command("database", func() {})
+	database.String("--host", &host, "HOST", "database host")
+
+	cases := []struct {
+		args    []string
+		dir     string
+		verbose bool
+	}{
+		{[]string{"-C", "/srv", "check", "database"}, "/srv", false},
+		{[]string{"check", "-C", "/srv", "database", "-v"}, "/srv", true},
+		{[]string{"check", "database", "-C", "/srv", "--verbose"}, "/srv", true},
+		{[]string{"check", "database", "--host", "db"}, "", false},
+	}
+	for _, c := range cases {
+		dir, verbose = "", false
+		err := g.Execute(c.args)
+		if err != nil || dir != c.dir || verbose != c.verbose {
+			t.Errorf("Execute(%v) returned %v, set dir = %q, verbose = %v, want nil, %q, %v",
+				c.args, err, dir, verbose, c.dir, c.verbose)
+		}
+	}
+
+	err := g.Execute([]string{"check", "database", "--verbose=yes"})
+	if err == nil {
+		t.Errorf("Execute accepted an invalid value for a persistent flag")
+	}
+
+	database.Columns = 80
+	want := `Usage: service check database [OPTION]
+
+Options:
+  --host HOST  database host
+
+Global options:
+  -v, --verbose  print details
+  -C PATH        run as if started in PATH
+`
+	if got := database.Help(); got != want {
+		t.Errorf("database.Help() == `%s`, want `%s`", got, want)
+	}
+}
+
+func persistentConflictTest(t *testing.T, f func(g *Group)) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Group didn't panic for conflicting persistent flag")
+		}
+	}()
+	f(NewGroup("service"))
+}
+
+func TestPersistentConflict(t *testing.T) {
+	persistentConflictTest(t, func(g *Group) {
+		g.Flag("-v", new(bool), "")
+		g.Persistent("-v")
+		g.Command("start", func() {}).Flag("-v --verbose", new(bool), "")
+	})
+	persistentConflictTest(t, func(g *Group) {
+		g.Group("check").Command("database", func() {}).Int("-p", new(int), "PORT", "")
+		g.Int("-p --port", new(int), "PORT", "")
+		g.Persistent("--port")
+	})
+}
+
+func TestGroupFlagsAfterCommand(t *testing.T) {
+	var dir, groupName, commandName string
+	g := NewGroup("service")
+	g.String("-C", &dir, "PATH", "")
+	g.String("-n --name", &groupName, "NAME", "")
+	start := g.Command("start", func() {})
+	start.String("-n --name", &commandName, "NAME", "")
+
+	cases := []struct {
+		args                        []string
+		dir, groupName, commandName string
+	}{
+		{[]string{"start", "-C", "/srv"}, "/srv", "", ""},
+		{[]string{"-C", "/srv", "-n", "a", "start", "--name", "b"}, "/srv", "a", "b"},
+		{[]string{"start", "--name=b", "-C/srv"}, "/srv", "", "b"},
+	}
+	for _, c := range cases {
+		dir, groupName, commandName = "", "", ""
+		err := g.Execute(c.args)
+		if err != nil || dir != c.dir || groupName != c.groupName || commandName != c.commandName {
+			t.Errorf("Execute(%v) returned %v, set %q, %q, %q, want nil, %q, %q, %q",
+				c.args, err, dir, groupName, commandName, c.dir, c.groupName, c.commandName)
+		}
+	}
+}
+
+func TestGroupAlias(t *testing.T) {
+	var removed, listed bool
+	b := new(strings.Builder)
+	g := NewGroup("service")
+	g.Stdout = b
+	g.Columns = 80
+	remove := g.Command("remove", func() { removed = true })
+	remove.Summary = "Remove a service"
+	g.Alias("remove", "rm")
+	list := g.Command("list", func() { listed = true })
+	list.Summary = "List services"
+	g.Alias("list", "ls", "l")
+
+	err := g.Execute([]string{"rm"})
+	if err != nil || !removed {
+		t.Errorf("Execute returned %v and removed = %v, want nil, true", err, removed)
+	}
+	err = g.Execute([]string{"l"})
+	if err != nil || !listed {
+		t.Errorf("Execute returned %v and listed = %v, want nil, true", err, listed)
+	}
+
+	want := `Usage: service COMMAND
+
+Commands:
+  remove, rm   Remove a service
+  list, ls, l  List services
+`
+	if got := g.Help(); got != want {
+		t.Errorf("g.Help() == `%s`, want `%s`", got, want)
+	}
+
+	err = g.Execute([]string{"help", "rm"})
+	if err != ErrHelp {
+		t.Errorf("Execute returned %v, want ErrHelp", err)
+	}
+	want = "Usage: service remove\n\nRemove a service\n"
+	if got := b.String(); got != want {
+		t.Errorf("Execute printed `%s`, want `%s`", got, want)
+	}
+}
+
+func aliasConflictTest(t *testing.T, name string, f func(g *Group)) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Group didn't panic for %s", name)
+		}
+	}()
+	g := NewGroup("service")
+	g.Command("remove", func() {})
+	g.Alias("remove", "rm")
+	g.Command("list", func() {})
+	f(g)
+}
+
+func TestAliasConflict(t *testing.T) {
+	aliasConflictTest(t, "rm", func(g *Group) { g.Alias("list", "rm") })
+	aliasConflictTest(t, "remove", func(g *Group) { g.Alias("list", "remove") })
+	aliasConflictTest(t, "help", func(g *Group) { g.Alias("list", "help") })
+	aliasConflictTest(t, "command rm", func(g *Group) { g.Command("rm", func() {}) })
+	aliasConflictTest(t, "group rm", func(g *Group) { g.Group("rm") })
+}
+
+func TestGroupHidden(t *testing.T) {
+	var called bool
+	g := NewGroup("service")
+	g.Columns = 80
+	g.Command("start", func() {}).Summary = "Start the service"
+	g.Command("debug", func() { called = true }).Hidden = true
+	g.Group("internal").Hidden = true
+
+	want := `Usage: service COMMAND
+
+Commands:
+  start  Start the service
+`
+	if got := g.Help(); got != want {
+		t.Errorf("g.Help() == `%s`, want `%s`", got, want)
+	}
+
+	err := g.Execute([]string{"debug"})
+	if err != nil || !called {
+		t.Errorf("Execute returned %v and called = %v, want nil, true", err, called)
+	}
+
+	h := NewGroup("h")
+	h.Command("debug", func() {}).Hidden = true
+	if got, want := h.usage(), "Usage: h"; got != want {
+		t.Errorf("h.usage() == `%s`, want `%s`", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import "strings"
+
+// Value is the interface to implement for user-defined flag types. Set parses a value from the
+// command-line and returns an error if it’s invalid. String returns the current value formatted
+// for the help message.
+type Value interface {
+	Set(string) error
+	String() string
+}
+
+// A Typer is a Value that provides a name for its type. Var uses it for the help message if no name
+// for the value is given.
+type Typer interface {
+	Type() string
+}
+
+// Var defines a flag with a user-defined type. If name is empty, the upper-case version of the
+// value’s Type() is used, or “VALUE” if it doesn’t implement Typer.
+//
+// If Set returns an error, parsing fails with the same message as for the built-in types.
+//
+// The help message shows the value’s String() as the default unless it’s empty, even if that’s the
+// type’s zero value; call HideDefault to leave it out.
+func (f *Flags) Var(spec string, v Value, name, usage string) {
+	if name == "" {
+		name = "VALUE"
+		if t, ok := v.(Typer); ok {
+			name = strings.ToUpper(t.Type())
+		}
+	}
+	o := f.addOption(spec, name, usage, setValue(v))
+	o.defaultValue = v.String()
+}
+
+// setValue returns a function that sets v and returns an error message like the built-in types.
+func setValue(v Value) func(name, value string) error {
+	return func(name, value string) error {
+		err := v.Set(value)
+		if err != nil {
+			return invalidArgument(name, value)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type logLevel int
+
+var logLevels = []string{"debug", "info", "warning", "error"}
+
+func (l *logLevel) Set(s string) error {
+	for i, name := range logLevels {
+		if s == name {
+			*l = logLevel(i)
+			return nil
+		}
+	}
+	return errors.New("unknown log level")
+}
+
+func (l *logLevel) String() string {
+	return logLevels[*l]
+}
+
+func (l *logLevel) Type() string {
+	return "level"
+}
+
+type nameList []string
+
+func (n *nameList) Set(s string) error {
+	*n = append(*n, s)
+	return nil
+}
+
+func (n *nameList) String() string {
+	return strings.Join(*n, ",")
+}
+
+func TestVarDefault(t *testing.T) {
+	var (
+		level logLevel
+		names nameList
+	)
+	f := newFlags()
+	f.Var("--log-level", &level, "", "log level")
+	f.Var("--name", &names, "NAME", "name")
+
+	want := []string{"log level (default: debug)", "name"}
+	for i, def := range f.definitions() {
+		if def.text != want[i] {
+			t.Errorf("definition %v has text `%v`, want `%v`", i, def.text, want[i])
+		}
+	}
+}
+
+func TestVar(t *testing.T) {
+	var level logLevel
+	f := newFlags()
+	f.Var("-l --log-level", &level, "", "")
+
+	_, _, err := f.parse([]string{"--log-level", "warning"}, false)
+	if err != nil {
+		t.Errorf("parse returned error %v", err)
+	}
+	if level != 2 {
+		t.Errorf("parse set level = %v, want %v", level, 2)
+	}
+
+	_, _, err = f.parse([]string{"-l", "verbose"}, false)
+	wantError := "invalid -l argument 'verbose'"
+	if err == nil || err.Error() != wantError {
+		t.Errorf("parse returned error %v, want %v", err, wantError)
+	}
+
+	wantTerms := []string{"-l LEVEL", "--log-level LEVEL"}
+	if got := f.definitions()[0].terms; !reflect.DeepEqual(got, wantTerms) {
+		t.Errorf("Var added terms %v, want %v", got, wantTerms)
+	}
+}